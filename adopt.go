@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/tagflag"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/covrom/torrentfs/store"
+)
+
+// Locates adopted data under the from dir, or at the mapped paths. Map keys
+// are file paths as in the watch dir, starting with the torrent name and
+// separated by slash.
+func adoptLocator(dir, from string, maps []string) (store.FileLocator, error) {
+	if from == "" && len(maps) == 0 {
+		return nil, nil
+	}
+	if from == "" {
+		from = dir
+	}
+	mm := make(map[string]string, len(maps))
+	for _, m := range maps {
+		i := strings.Index(m, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("bad mapping %q, want torrent/path=native/path", m)
+		}
+		mm[path.Clean(m[:i])] = m[i+1:]
+	}
+	return func(info *metainfo.Info, fi metainfo.FileInfo) string {
+		rel := path.Join(append([]string{info.Name}, fi.Path...)...)
+		if p, ok := mm[rel]; ok {
+			return p
+		}
+		return filepath.Join(from, filepath.FromSlash(rel))
+	}, nil
+}
+
+// Adopts the data of the torrent into the dir, hashing pieces by workers in
+// parallel, and writes a match summary. Returns the completion of each piece.
+func adopt(w io.Writer, dir string, pc store.PieceCompletion, mi *metainfo.MetaInfo, locate store.FileLocator, move bool, workers int) (ok []bool, err error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return
+	}
+	ih := mi.HashInfoBytes()
+	fms, err := store.Adopt(dir, pc, &info, ih, locate, move, workers, bytesLimiter(args.VerifyRate))
+	if err != nil {
+		return
+	}
+	for i, fi := range info.UpvertedFiles() {
+		fm := fms[i]
+		fmt.Fprintf(w, "%s: %d/%d pieces ok", path.Join(append([]string{info.Name}, fi.Path...)...), fm.Ok, fm.Pieces)
+		if fm.Placed {
+			fmt.Fprintf(w, ", placed from %s", fm.Path)
+		}
+		fmt.Fprintln(w)
+	}
+	ok = make([]bool, info.NumPieces())
+	for i := range ok {
+		c, _ := pc.Get(metainfo.PieceKey{InfoHash: ih, Index: i})
+		ok[i] = c.Complete
+	}
+	fmt.Fprintf(w, "%s: %d/%d pieces ok\n", info.Name, len(ok)-numFailed(ok), len(ok))
+	return
+}
+
+// The "adopt" subcommand marks existing data of torrent files as complete
+// in a watch dir, while the daemon isn't running.
+func adoptExitCode(argv []string) int {
+	aargs := struct {
+		Dir     string   `help:"watch dir to adopt the data into"`
+		From    string   `help:"dir where the data is found, the watch dir by default"`
+		Map     []string `help:"torrent/path=native/path of a file found elsewhere"`
+		Move    bool     `help:"move found files into the watch dir instead of linking"`
+		Workers int      `help:"pieces hashed in parallel"`
+		tagflag.StartPos
+		Torrents []string `arity:"+" help:"torrent files"`
+	}{
+		Dir:     ".",
+		Workers: 2,
+	}
+	tagflag.ParseArgs(&aargs, argv, tagflag.Program("torrentfs adopt"))
+
+	locate, err := adoptLocator(aargs.Dir, aargs.From, aargs.Map)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	pc, err := store.OpenPieceCompletion(aargs.Dir, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't open piece completion db in %q (is the daemon running? use /adopt): %s\n", aargs.Dir, err)
+		return 1
+	}
+	defer pc.Close()
+
+	ret := 0
+	for _, fn := range aargs.Torrents {
+		mi, err := metainfo.LoadFromFile(fn)
+		if err == nil {
+			_, err = adopt(os.Stdout, aargs.Dir, pc, mi, locate, aargs.Move, aargs.Workers)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error adopting %s: %s\n", fn, err)
+			ret = 1
+		}
+	}
+	return ret
+}
+
+// Adopts data of a torrent file into a watch dir of the running daemon and
+// adds the torrent, or lets the client recheck it if it's already added.
+func handleAdopt(client *torrent.Client, chq chan *torrent.Torrent, wds *watchDirs, wg *sync.WaitGroup, done chan bool) {
+	http.HandleFunc("/adopt", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		wd := wds.get(req.FormValue("dir"))
+		if wd == nil {
+			http.Error(w, "unknown watch dir", http.StatusNotFound)
+			return
+		}
+		if wd.Storage != store.BackendFile && wd.Storage != store.BackendMMap {
+			http.Error(w, "data can be adopted only by file or mmap storage", http.StatusBadRequest)
+			return
+		}
+		mi, err := metainfo.LoadFromFile(req.FormValue("torrent"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		locate, err := adoptLocator(wd.dataDir(), req.FormValue("from"), req.Form["map"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ok, err := adopt(w, wd.dataDir(), wd.pc, mi, locate, req.FormValue("move") != "", args.VerifyWorkers)
+		if err != nil {
+			fmt.Fprintf(w, "error adopting: %s\n", err)
+			return
+		}
+		log.Printf("adopted %s into %s", req.FormValue("torrent"), wd.dataDir())
+		if e := ttreg.get(mi.HashInfoBytes()); e != nil {
+			<-e.t.GotInfo()
+			for i, c := range ok {
+				if c != e.t.PieceState(i).Complete {
+					e.t.Piece(i).VerifyData()
+				}
+			}
+			return
+		}
+		if _, err := addmi(client, chq, wd, mi, "", nil, wg, done); err != nil && err != errDuplicate {
+			fmt.Fprintf(w, "error adding torrent: %s\n", err)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// Settings of categories, the subdirectories of recursive watch dirs.
+type categoryDirs struct {
+	mu   sync.Mutex
+	conf map[string]*watchDir
+	// Opened categories with their own data path.
+	open map[string]*watchDir
+}
+
+var cats = &categoryDirs{
+	conf: make(map[string]*watchDir),
+	open: make(map[string]*watchDir),
+}
+
+// Parses categories separated by semicolon, each in the form
+// name?path=dir&name=value. Without path, data of the category is stored
+// in the watch dir the .torrent file is found in.
+func (cs *categoryDirs) parse(s string) error {
+	for _, c := range strings.Split(s, ";") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		cd := newWatchDir("")
+		cd.Category = c
+		if i := strings.IndexByte(c, '?'); i >= 0 {
+			cd.Category = c[:i]
+			err := cd.parseSettings(c[i+1:], func(k, v string) error {
+				if k != "path" {
+					return fmt.Errorf("unknown setting %q", k)
+				}
+				cd.Dir = v
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("category %q: %s", cd.Category, err)
+			}
+		}
+		cs.conf[cd.Category] = cd
+	}
+	return nil
+}
+
+// Reports whether the dir is the data path of a category.
+func (cs *categoryDirs) isDataDir(dir string) bool {
+	for _, cd := range cs.conf {
+		if cd.Dir == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *categoryDirs) close() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, cd := range cs.open {
+		cd.close()
+	}
+}
+
+// Returns where torrents of the category found in the watch dir are stored.
+// Categories with their own data path are opened once and added to wds.
+func (wd *watchDir) target(cat string, wds *watchDirs) (*watchDir, error) {
+	cd, ok := cats.conf[cat]
+	if !ok {
+		return wd, nil
+	}
+	if cd.Dir != "" {
+		cats.mu.Lock()
+		defer cats.mu.Unlock()
+		if t, ok := cats.open[cat]; ok {
+			return t, nil
+		}
+		if err := cd.open(); err != nil {
+			return nil, err
+		}
+		cats.open[cat] = cd
+		wds.add(cd)
+		return cd, nil
+	}
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if t, ok := wd.cats[cat]; ok {
+		return t, nil
+	}
+	t := newWatchDir(wd.Dir)
+	t.Category = cat
+	t.Storage = wd.Storage
+	t.Data = wd.Data
+	t.AliveMinutes = cd.AliveMinutes
+	t.StallMinutes = cd.StallMinutes
+	t.Strategy = cd.Strategy
+	// Limits of a category hold for all its dirs.
+	t.rates = cd.rates
+	t.raw = wd.raw
+	t.pc = wd.pc
+	t.sti = t.throttled(wd.sti)
+	t.upLims = append([]*rate.Limiter{t.rates.up}, wd.upLims...)
+	t.shared = true
+	if wd.cats == nil {
+		wd.cats = make(map[string]*watchDir)
+	}
+	wd.cats[cat] = t
+	return t, nil
+}
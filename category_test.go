@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+// The rates of a category hold for it across watch dirs.
+func TestCategoryRatesShared(t *testing.T) {
+	old := cats.conf
+	defer func() { cats.conf = old }()
+	cats.conf = make(map[string]*watchDir)
+	if err := cats.parse("c?up=1MiB&down=2MiB"); err != nil {
+		t.Fatal(err)
+	}
+	wds := &watchDirs{}
+	t1, err := newWatchDir("a").target("c", wds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := newWatchDir("b").target("c", wds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if t1 == t2 || t1.rates != t2.rates || t1.rates != cats.conf["c"].rates {
+		t.Fatal("category dirs have rates of their own")
+	}
+	if t1.upLims[0] != t2.upLims[0] {
+		t.Error("category dirs have upload limiters of their own")
+	}
+	if up, down := t1.rates.get(); up != 1<<20 || down != 2<<20 {
+		t.Errorf("rates up %d, down %d", up, down)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/tagflag"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/covrom/torrentfs/store"
+)
+
+type createOpts struct {
+	PieceLength int64
+	// Each tracker is a tier of its own.
+	Trackers []string
+	WebSeeds []string
+	Private  bool
+	Comment  string
+	Source   string
+}
+
+// Picks a power of two piece length between 16KiB and 16MiB, giving about
+// 1500 pieces.
+func autoPieceLength(total int64) int64 {
+	l := int64(16 << 10)
+	for l < 16<<20 && total/l > 1500 {
+		l <<= 1
+	}
+	return l
+}
+
+func totalSize(root string) (n int64, err error) {
+	err = filepath.Walk(root, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			n += fi.Size()
+		}
+		return err
+	})
+	return
+}
+
+// Builds the metainfo of the file or dir, hashing its data.
+func createTorrent(root string, o createOpts) (*metainfo.MetaInfo, error) {
+	root = filepath.Clean(root)
+	info := metainfo.Info{PieceLength: o.PieceLength, Source: o.Source}
+	if info.PieceLength <= 0 {
+		total, err := totalSize(root)
+		if err != nil {
+			return nil, err
+		}
+		info.PieceLength = autoPieceLength(total)
+	}
+	if o.Private {
+		info.Private = &o.Private
+	}
+	if err := info.BuildFromFilePath(root); err != nil {
+		return nil, err
+	}
+	ib, err := bencode.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	mi := &metainfo.MetaInfo{
+		InfoBytes:    ib,
+		Comment:      o.Comment,
+		CreatedBy:    AppVersion,
+		CreationDate: time.Now().Unix(),
+		UrlList:      o.WebSeeds,
+	}
+	for _, tr := range o.Trackers {
+		mi.AnnounceList = append(mi.AnnounceList, []string{tr})
+	}
+	if len(o.Trackers) > 0 {
+		mi.Announce = o.Trackers[0]
+	}
+	return mi, nil
+}
+
+func writeTorrent(mi *metainfo.MetaInfo, fn string) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	err = mi.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// The "create" subcommand writes a .torrent file of a local file or dir.
+func createExitCode(argv []string) int {
+	cargs := struct {
+		Out         string        `help:"torrent file to write, the name of the data with .torrent by default"`
+		PieceLength tagflag.Bytes `help:"piece length, picked by the data size by default"`
+		Tracker     []string      `help:"tracker url, each in a tier of its own"`
+		TrackerAddr string        `help:"address of the embedded tracker of the daemon, announced to without trackers"`
+		TrackerURL  string        `help:"announce url of the embedded tracker of the daemon, http://hostname:port/announce of trackerAddr by default"`
+		WebSeed     []string      `help:"web seed url"`
+		Private     bool          `help:"set the private flag"`
+		Comment     string        `help:"comment of the torrent"`
+		Source      string        `help:"source tag, making the info hash unique to a tracker"`
+		tagflag.StartPos
+		Path string `help:"file or dir to create the torrent of"`
+	}{}
+	tagflag.ParseArgs(&cargs, argv, tagflag.Program("torrentfs create"))
+
+	mi, err := createTorrent(cargs.Path, createOpts{
+		PieceLength: cargs.PieceLength.Int64(),
+		Trackers:    createdTrackers(cargs.Tracker, cargs.TrackerURL, cargs.TrackerAddr),
+		WebSeeds:    cargs.WebSeed,
+		Private:     cargs.Private,
+		Comment:     cargs.Comment,
+		Source:      cargs.Source,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating torrent of %s: %s\n", cargs.Path, err)
+		return 1
+	}
+	out := cargs.Out
+	if out == "" {
+		out = filepath.Base(filepath.Clean(cargs.Path)) + ".torrent"
+	}
+	if err := writeTorrent(mi, out); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing %s: %s\n", out, err)
+		return 1
+	}
+	fmt.Printf("%s: %s\n", out, mi.HashInfoBytes().HexString())
+	return 0
+}
+
+// Marks all pieces of the torrent complete.
+func markComplete(pc store.PieceCompletion, mi *metainfo.MetaInfo) error {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return err
+	}
+	ih := mi.HashInfoBytes()
+	for i := 0; i < info.NumPieces(); i++ {
+		if err := pc.Set(metainfo.PieceKey{InfoHash: ih, Index: i}, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Opens the dir holding created data as file storage, once, unless a watch
+// dir stores its data there. It isn't watched nor listed with the watch dirs.
+func seedDir(dir string, wds *watchDirs) (*watchDir, error) {
+	if wd := wds.getData(dir); wd != nil {
+		if wd.Storage != store.BackendFile && wd.Storage != store.BackendMMap {
+			return nil, fmt.Errorf("%s isn't stored in files", dir)
+		}
+		return wd, nil
+	}
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	if wd, ok := wds.seeds[dir]; ok {
+		return wd, nil
+	}
+	wd := newWatchDir(dir)
+	wd.Storage = store.BackendFile
+	if err := wd.open(); err != nil {
+		return nil, err
+	}
+	if wds.seeds == nil {
+		wds.seeds = make(map[string]*watchDir)
+	}
+	wds.seeds[dir] = wd
+	return wd, nil
+}
+
+// Creates a .torrent file of a local path at out, and seeds it from the path
+// with seed=1. Without trackers given, the embedded tracker is used if it
+// runs.
+func handleCreate(client *torrent.Client, chq chan *torrent.Torrent, wds *watchDirs, wg *sync.WaitGroup, done chan bool) {
+	var mu sync.Mutex
+	http.HandleFunc("/create", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req.ParseForm()
+		root := filepath.Clean(req.FormValue("path"))
+		out := req.FormValue("out")
+		if req.FormValue("path") == "" || out == "" {
+			http.Error(w, "path and out are required", http.StatusBadRequest)
+			return
+		}
+		var pl tagflag.Bytes
+		if s := req.FormValue("piece"); s != "" {
+			if err := pl.Marshal(s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		trs := req.Form["tracker"]
+		if lanTracker != nil {
+			trs = createdTrackers(trs, args.TrackerURL, args.TrackerAddr)
+		}
+		mi, err := createTorrent(root, createOpts{
+			PieceLength: pl.Int64(),
+			Trackers:    trs,
+			WebSeeds:    req.Form["webseed"],
+			Private:     req.FormValue("private") != "",
+			Comment:     req.FormValue("comment"),
+			Source:      req.FormValue("source"),
+		})
+		if err == nil {
+			err = writeTorrent(mi, out)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("created %s of %s", out, root)
+		fmt.Fprintf(w, "%s: %s\n", out, mi.HashInfoBytes().HexString())
+		if req.FormValue("seed") == "" {
+			return
+		}
+		mu.Lock()
+		wd, err := seedDir(filepath.Dir(root), wds)
+		mu.Unlock()
+		if err == nil {
+			err = markComplete(wd.pc, mi)
+		}
+		if err == nil {
+			_, err = addmi(client, chq, wd, mi, "", nil, wg, done)
+		}
+		if err != nil && err != errDuplicate {
+			fmt.Fprintf(w, "error seeding: %s\n", err)
+			return
+		}
+		log.Printf("seeding %s from %s", out, root)
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht"
+	"github.com/anacrolix/dht/krpc"
+	"github.com/anacrolix/torrent"
+)
+
+// Nodes the DHT starts from: the saved node table, then the bootstrap nodes.
+func dhtStartingNodes() ([]dht.Addr, error) {
+	var addrs []dht.Addr
+	ns, err := dht.ReadNodesFromFile(args.DhtNodesFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("error reading dht nodes from %s: %s\n", args.DhtNodesFile, err)
+	}
+	for _, ni := range ns {
+		addrs = append(addrs, dht.NewAddr(ni.Addr.UDP()))
+	}
+	var bs []dht.Addr
+	if args.DhtNodes == "" {
+		bs, err = dht.GlobalBootstrapAddrs()
+	} else {
+		bs, err = resolveDhtNodes(args.DhtNodes)
+	}
+	addrs = append(addrs, bs...)
+	if len(addrs) == 0 {
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// Resolves host:port nodes separated by semicolon.
+func resolveDhtNodes(s string) (addrs []dht.Addr, err error) {
+	for _, n := range strings.Split(s, ";") {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+		ua, err := net.ResolveUDPAddr("udp", n)
+		if err != nil {
+			log.Printf("error resolving dht node %q: %s\n", n, err)
+			continue
+		}
+		addrs = append(addrs, dht.NewAddr(ua))
+	}
+	if len(addrs) == 0 {
+		err = errors.New("no dht nodes resolved")
+	}
+	return
+}
+
+// Writes the node tables of the DHT servers to the nodes file. An empty table
+// doesn't overwrite the saved one.
+func saveDhtNodes(client *torrent.Client) {
+	var ns []krpc.NodeInfo
+	for _, s := range dhtServers(client) {
+		ns = append(ns, s.Nodes()...)
+	}
+	if len(ns) == 0 {
+		return
+	}
+	tmp := args.DhtNodesFile + ".tmp"
+	err := dht.WriteNodesToFile(ns, tmp)
+	if err == nil {
+		err = os.Rename(tmp, args.DhtNodesFile)
+	}
+	if err != nil {
+		log.Printf("error saving dht nodes: %s\n", err)
+		return
+	}
+	log.Printf("saved %d dht nodes to %s", len(ns), args.DhtNodesFile)
+}
+
+// Saves the DHT nodes every interval until done.
+func runSaveDhtNodes(client *torrent.Client, interval time.Duration, wg *sync.WaitGroup, done chan bool) {
+	defer wg.Done()
+	tck := time.NewTicker(interval)
+	defer tck.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tck.C:
+			saveDhtNodes(client)
+		}
+	}
+}
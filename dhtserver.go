@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Interval of DHT announces of each torrent, as in the client's own DHT.
+const dhtAnnounceInterval = 5 * time.Minute
+
+// DHT server on a UDP socket of its own, set up when DhtAddr is given in
+// place of the client's DHT, which shares the peer listen sockets.
+var ownDht *dht.Server
+
+// Starts the DHT server on addr, adding the peers announced to it to the
+// torrents of the client.
+func startDht(client *torrent.Client, addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	s, err := dht.NewServer(&dht.ServerConfig{
+		Conn:          pc,
+		IPBlocklist:   bans,
+		StartingNodes: dhtStartingNodes,
+		OnAnnouncePeer: func(ih metainfo.Hash, p dht.Peer) {
+			if t, ok := client.Torrent(ih); ok {
+				t.AddPeers([]torrent.Peer{{IP: p.IP, Port: p.Port, Source: "Ha"}})
+			}
+		},
+	})
+	if err != nil {
+		pc.Close()
+		return err
+	}
+	go func() {
+		if _, err := s.Bootstrap(); err != nil {
+			log.Printf("error bootstrapping dht: %s\n", err)
+		}
+	}()
+	ownDht = s
+	log.Printf("dht listening on %s", s.Addr())
+	return nil
+}
+
+// DHT servers of the client and the own one.
+func dhtServers(client *torrent.Client) []*dht.Server {
+	ss := client.DhtServers()
+	if ownDht != nil {
+		ss = append(ss, ownDht)
+	}
+	return ss
+}
+
+// Announces a torrent to the own DHT and adds the peers found, until the
+// announce ends or done is closed.
+func announceDht(client *torrent.Client, t *torrent.Torrent, done chan bool) {
+	a, err := ownDht.Announce(t.InfoHash(), client.LocalPort(), true)
+	if err != nil {
+		log.Printf("error announcing %s to dht: %s\n", t.Name(), err)
+		return
+	}
+	defer a.Close()
+	for {
+		var v dht.PeersValues
+		var ok bool
+		select {
+		case <-done:
+			return
+		case v, ok = <-a.Peers:
+			if !ok {
+				return
+			}
+		}
+		ps := make([]torrent.Peer, 0, len(v.Peers))
+		for _, cp := range v.Peers {
+			if cp.Port != 0 {
+				ps = append(ps, torrent.Peer{IP: cp.IP[:], Port: cp.Port, Source: "Hg"})
+			}
+		}
+		t.AddPeers(ps)
+	}
+}
+
+// Reports whether the torrent is private, kept off the DHT by BEP 27. It's
+// unknown until the info is, so magnets are announced to find it.
+func isPrivate(t *torrent.Torrent) bool {
+	info := t.Info()
+	return info != nil && info.Private != nil && *info.Private
+}
+
+// Announces the public torrents of the client to the own DHT each announce
+// interval, new ones within seconds of being added, until done.
+func runDhtAnnounces(client *torrent.Client, wg *sync.WaitGroup, done chan bool) {
+	defer wg.Done()
+	var awg sync.WaitGroup
+	defer awg.Wait()
+	last := make(map[metainfo.Hash]time.Time)
+	for {
+		now := time.Now()
+		seen := make(map[metainfo.Hash]bool)
+		for _, t := range client.Torrents() {
+			ih := t.InfoHash()
+			seen[ih] = true
+			if isPrivate(t) || now.Sub(last[ih]) < dhtAnnounceInterval {
+				continue
+			}
+			last[ih] = now
+			awg.Add(1)
+			go func(t *torrent.Torrent) {
+				defer awg.Done()
+				announceDht(client, t, done)
+			}(t)
+		}
+		for ih := range last {
+			if !seen[ih] {
+				delete(last, ih)
+			}
+		}
+		select {
+		case <-done:
+			ownDht.Close()
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
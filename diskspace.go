@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/anacrolix/torrent"
+	"github.com/covrom/torrentfs/store"
+)
+
+// Free bytes available to unprivileged users on the filesystem of the dir.
+// A dir that isn't created yet is on the filesystem of its parent.
+func freeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	for {
+		err := syscall.Statfs(dir, &st)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			return 0, err
+		}
+		dir = filepath.Dir(dir)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// Device of the filesystem of the dir, of its parent if it isn't created yet.
+func fsDevice(dir string) (uint64, error) {
+	for {
+		fi, err := os.Stat(dir)
+		if err == nil {
+			return uint64(fi.Sys().(*syscall.Stat_t).Dev), nil
+		}
+		if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			return 0, err
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// Active downloads by the filesystem device of their data, whose missing
+// bytes are reserved on it.
+var reservations = struct {
+	mu sync.Mutex
+	m  map[*torrent.Torrent]uint64
+}{m: make(map[*torrent.Torrent]uint64)}
+
+// Missing bytes of the downloads reserved on the device, but the torrent.
+func reservedOn(dev uint64, except *torrent.Torrent) (n int64) {
+	for t, d := range reservations.m {
+		if d == dev && t != except {
+			n += t.BytesMissing()
+		}
+	}
+	return
+}
+
+// Reports whether the bytes fit into the free space of the dir, keeping the
+// reserve free and the missing bytes of the other downloads reserved on the
+// filesystem.
+func (wd *watchDir) fits(t *torrent.Torrent, need int64) bool {
+	reservations.mu.Lock()
+	defer reservations.mu.Unlock()
+	ok, _ := wd.fitsLocked(t, need)
+	return ok
+}
+
+func (wd *watchDir) fitsLocked(t *torrent.Torrent, need int64) (bool, uint64) {
+	if wd.Storage == store.BackendMemory {
+		return true, 0
+	}
+	free, err := freeSpace(wd.dataDir())
+	if err == nil {
+		var dev uint64
+		if dev, err = fsDevice(wd.dataDir()); err == nil {
+			return int64(free)-int64(args.DiskReserve)-reservedOn(dev, t) >= need, dev
+		}
+	}
+	log.Printf("error getting free space of %s: %s\n", wd.dataDir(), err)
+	return true, 0
+}
+
+// Reserves the missing bytes of the torrent on the filesystem of the dir if
+// they fit, reporting whether they do.
+func (wd *watchDir) reserve(t *torrent.Torrent) bool {
+	reservations.mu.Lock()
+	defer reservations.mu.Unlock()
+	ok, dev := wd.fitsLocked(t, t.BytesMissing())
+	if ok && wd.Storage != store.BackendMemory {
+		reservations.m[t] = dev
+	}
+	return ok
+}
+
+func unreserve(t *torrent.Torrent) {
+	reservations.mu.Lock()
+	delete(reservations.m, t)
+	reservations.mu.Unlock()
+}
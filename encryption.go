@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/mse"
+)
+
+// Encryption modes of peer conns.
+const (
+	// Plaintext streams, obfuscated handshakes only if the peer asks.
+	encryptionDisabled = "disabled"
+	// Plaintext handshakes first, plaintext streams when peers allow them.
+	encryptionPlaintext = "plaintext"
+	// Obfuscated handshakes first, encrypted streams when peers allow them.
+	encryptionPrefer = "prefer"
+	// Encrypted streams only, other peers are dropped.
+	encryptionRequire = "require"
+)
+
+func encryptionPolicy(mode string) (ep torrent.EncryptionPolicy, err error) {
+	switch mode {
+	case encryptionDisabled:
+		ep.DisableEncryption = true
+	case encryptionPlaintext:
+		ep.PreferNoEncryption = true
+	case encryptionPrefer:
+	case encryptionRequire:
+		ep.ForceEncryption = true
+	default:
+		err = fmt.Errorf("unknown encryption mode %q", mode)
+	}
+	return
+}
+
+// Describes the encryption of a peer conn.
+func connEncryption(pc torrent.PeerConnInfo) string {
+	switch {
+	case !pc.HeaderEncrypted:
+		return "plain"
+	case pc.CryptoMethod == mse.CryptoMethodRC4:
+		return "rc4"
+	default:
+		return "obfuscated"
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RSS or Atom feed of torrents, fetched into a watch dir.
+type feed struct {
+	URL    string
+	Dir    string
+	Filter *regexp.Regexp
+}
+
+// Reads feeds from the file, one per line as url, target dir and an optional
+// regexp matching item titles, separated by blanks. Lines starting with # are
+// comments.
+func loadFeeds(fn string) (fs []feed, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		fields := strings.Fields(l)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: want url, dir and optional filter", fn, n)
+		}
+		fd := feed{URL: fields[0], Dir: fields[1]}
+		if len(fields) > 2 {
+			// The filter is the rest of the line, its spaces kept.
+			rest := l[len(fields[0]):]
+			rest = rest[strings.Index(rest, fields[1])+len(fields[1]):]
+			fd.Filter, err = regexp.Compile(strings.TrimSpace(rest))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", fn, n, err)
+			}
+		}
+		fs = append(fs, fd)
+	}
+	return fs, s.Err()
+}
+
+// Checks that the feeds fetch into watch dirs.
+func checkFeedDirs(fs []feed, wds *watchDirs) error {
+	for _, fd := range fs {
+		if wds.get(fd.Dir) == nil {
+			return fmt.Errorf("feed %s: %s isn't a watch dir", fd.URL, fd.Dir)
+		}
+	}
+	return nil
+}
+
+type feedItem struct {
+	ID    string
+	Title string
+	URL   string
+}
+
+// Both RSS 2.0 and Atom documents decode into it.
+type feedDoc struct {
+	Items []struct {
+		Title     string `xml:"title"`
+		GUID      string `xml:"guid"`
+		Link      string `xml:"link"`
+		Enclosure struct {
+			URL string `xml:"url,attr"`
+		} `xml:"enclosure"`
+	} `xml:"channel>item"`
+	Entries []struct {
+		Title string `xml:"title"`
+		ID    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Returns the items of the feed that have a .torrent url.
+func parseFeed(r io.Reader) ([]feedItem, error) {
+	var doc feedDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var its []feedItem
+	for _, i := range doc.Items {
+		it := feedItem{ID: i.GUID, Title: i.Title, URL: i.Enclosure.URL}
+		if it.URL == "" {
+			it.URL = i.Link
+		}
+		its = append(its, it)
+	}
+	for _, e := range doc.Entries {
+		it := feedItem{ID: e.ID, Title: e.Title}
+		for _, l := range e.Links {
+			if it.URL == "" || l.Rel == "enclosure" || l.Type == "application/x-bittorrent" {
+				it.URL = l.Href
+			}
+		}
+		its = append(its, it)
+	}
+	var ret []feedItem
+	for _, it := range its {
+		if !strings.HasPrefix(it.URL, "http://") && !strings.HasPrefix(it.URL, "https://") {
+			continue
+		}
+		if it.ID == "" {
+			it.ID = it.URL
+		}
+		ret = append(ret, it)
+	}
+	return ret, nil
+}
+
+// Ids of feed items already fetched, appended to a file so they aren't
+// fetched again after restart.
+type feedHistory struct {
+	mu   sync.Mutex
+	fn   string
+	seen map[string]bool
+}
+
+func openFeedHistory(fn string) (*feedHistory, error) {
+	h := &feedHistory{fn: fn, seen: make(map[string]bool)}
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		h.seen[s.Text()] = true
+	}
+	return h, s.Err()
+}
+
+func (h *feedHistory) has(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.seen[id]
+}
+
+func (h *feedHistory) add(id string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seen[id] = true
+	f, err := os.OpenFile(h.fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, id)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Fetches new matching items of the feed into its dir.
+func (fd feed) check(h *feedHistory) error {
+	resp, err := fetch(fd.URL)
+	if err != nil {
+		return err
+	}
+	its, err := parseFeed(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("parsing feed %s: %s", fd.URL, err)
+	}
+	for _, it := range its {
+		if h.has(it.ID) || (fd.Filter != nil && !fd.Filter.MatchString(it.Title)) {
+			continue
+		}
+		fn, err := fetchTorrent(it.URL, fd.Dir)
+		if err != nil {
+			log.Printf("error fetching %q of feed %s: %s\n", it.Title, fd.URL, err)
+			continue
+		}
+		log.Printf("fetched %q of feed %s to %s\n", it.Title, fd.URL, fn)
+		if err := h.add(it.ID); err != nil {
+			log.Printf("error saving feed history: %s\n", err)
+		}
+	}
+	return nil
+}
+
+// Checks the feeds every interval until done, only once if it's 0.
+func runFeeds(fs []feed, h *feedHistory, interval time.Duration, done chan bool) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		tck := time.NewTicker(interval)
+		defer tck.Stop()
+		tick = tck.C
+	}
+	for {
+		for _, fd := range fs {
+			if err := fd.check(h); err != nil {
+				log.Printf("error checking feed: %s\n", err)
+			}
+		}
+		select {
+		case <-done:
+			return
+		case <-tick:
+		}
+	}
+}
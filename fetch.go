@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Larger responses aren't .torrent files.
+const maxTorrentFileSize = 32 << 20
+
+// Used for fetching .torrent files and feeds.
+var fetchClient = &http.Client{Timeout: 30 * time.Second}
+
+func fetch(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", args.FetchUserAgent)
+	if args.FetchCookies != "" {
+		req.Header.Set("Cookie", args.FetchCookies)
+	}
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// Fetches the .torrent file into the dir, where it's ingested as a dropped
+// one. The file appears by rename, once it's completely written. Returns the
+// path of the file.
+func fetchTorrent(url, dir string) (string, error) {
+	resp, err := fetch(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTorrentFileSize))
+	if err != nil {
+		return "", err
+	}
+	mi, err := metainfo.Load(bytes.NewReader(b))
+	if err == nil {
+		_, err = mi.UnmarshalInfo()
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %s", url, err)
+	}
+	fn := filepath.Join(dir, mi.HashInfoBytes().HexString()+".torrent")
+	tmp := filepath.Join(dir, ".#"+filepath.Base(fn))
+	if err := ioutil.WriteFile(tmp, b, 0660); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return fn, nil
+}
+
+// Fetches a .torrent file by url into a watch dir, the first one by default.
+func handleAddURL(wds *watchDirs) {
+	http.HandleFunc("/addurl", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var wd *watchDir
+		if dir := req.FormValue("dir"); dir != "" {
+			wd = wds.get(dir)
+		} else if ds := wds.list(); len(ds) > 0 {
+			wd = ds[0]
+		}
+		if wd == nil {
+			http.Error(w, "no watch dir found", http.StatusBadRequest)
+			return
+		}
+		fn, err := fetchTorrent(req.FormValue("url"), wd.Dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, "fetched %s\n", fn)
+	})
+}
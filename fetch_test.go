@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestHandleAddURL(t *testing.T) {
+	info := metainfo.Info{Name: "a", PieceLength: 16 << 10, Pieces: make([]byte, 20), Length: 1}
+	ib, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := metainfo.MetaInfo{InfoBytes: ib}
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer tsrv.Close()
+
+	dir, err := ioutil.TempDir("", "torrentfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cat := filepath.Join(dir, "cat")
+	wds := &watchDirs{ds: []*watchDir{{Dir: dir}, {Dir: cat, Category: "cat"}}}
+	handleAddURL(wds)
+	srv := httptest.NewServer(http.DefaultServeMux)
+	defer srv.Close()
+
+	addURL := func(dir string) int {
+		q := url.Values{"url": {tsrv.URL + "/a.torrent"}}
+		if dir != "" {
+			q.Set("dir", dir)
+		}
+		resp, err := http.Get(srv.URL + "/addurl?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := addURL(dir); code != http.StatusOK {
+		t.Fatalf("adding to the watch dir: %d", code)
+	}
+	fn := filepath.Join(dir, mi.HashInfoBytes().HexString()+".torrent")
+	if b, err := ioutil.ReadFile(fn); err != nil || !bytes.Equal(b, buf.Bytes()) {
+		t.Fatalf("fetched %s: %v", fn, err)
+	}
+	if code := addURL(filepath.Join(dir, "other")); code != http.StatusBadRequest {
+		t.Errorf("adding to a dir not watched: %d", code)
+	}
+	if code := addURL(cat); code != http.StatusBadRequest {
+		t.Errorf("adding to the data path of a category: %d", code)
+	}
+	wds.ds = nil
+	if code := addURL(""); code != http.StatusBadRequest {
+		t.Errorf("adding without watch dirs: %d", code)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+)
+
+// Publishes health of watch dirs to expvar and serves it at /health.
+// Responds with 503 if any of the dirs is unhealthy.
+func handleHealth(wds *watchDirs) {
+	expvar.Publish("watchDirs", expvar.Func(func() interface{} {
+		m := make(map[string]string)
+		for _, wd := range wds.list() {
+			m[wd.Dir] = wd.Status()
+		}
+		return m
+	}))
+
+	http.HandleFunc("/health", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ds := wds.list()
+		for _, wd := range ds {
+			if wd.health() != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				break
+			}
+		}
+		for _, wd := range ds {
+			fmt.Fprintf(w, "%s: %s\n", wd.Dir, wd.Status())
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Actions on a source .torrent file once the torrent is queued.
+const (
+	ingestKeep    = "keep"
+	ingestDelete  = "delete"
+	ingestRename  = "rename"
+	ingestArchive = "archive"
+)
+
+const ingestedSuffix = ".added"
+
+func checkIngestAction(a string) error {
+	switch a {
+	case ingestKeep, ingestDelete, ingestRename, ingestArchive:
+		return nil
+	}
+	return fmt.Errorf("unknown ingest action %q", a)
+}
+
+// Relative paths are under the watch dir.
+func (wd *watchDir) subdir(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(wd.Dir, p)
+}
+
+// Applies the ingest action of the dir to the source file of the queued
+// torrent. The source is forgotten unless it's kept, so that its removal
+// isn't taken for the removal by user.
+func (wd *watchDir) ingested(e *ttEntry) {
+	fn := e.Src()
+	if fn == "" || wd.Ingest == ingestKeep {
+		return
+	}
+	e.setSrc("")
+	wd.ingestFile(fn)
+}
+
+// Deletes, renames or archives the source file by the ingest action.
+func (wd *watchDir) ingestFile(fn string) {
+	var err error
+	switch wd.Ingest {
+	case ingestDelete:
+		log.Printf("delete file %s", fn)
+		err = os.Remove(fn)
+	case ingestRename:
+		log.Printf("rename file %s", fn)
+		err = os.Rename(fn, fn+ingestedSuffix)
+	case ingestArchive:
+		dir := wd.subdir(wd.ArchiveDir)
+		log.Printf("archive file %s to %s", fn, dir)
+		_, err = moveFile(fn, dir)
+	}
+	if err != nil {
+		log.Printf("error handling ingested file %s: %s\n", fn, err)
+	}
+}
+
+// Moves the source file that can't be added to the failed dir, with the
+// error written next to it.
+func (wd *watchDir) failed(fn string, ferr error) {
+	dir := wd.subdir(wd.FailedDir)
+	log.Printf("move failed file %s to %s", fn, dir)
+	dst, err := moveFile(fn, dir)
+	if err == nil {
+		err = ioutil.WriteFile(dst+".error", []byte(ferr.Error()+"\n"), 0660)
+	}
+	if err != nil {
+		log.Printf("error moving failed file %s: %s\n", fn, err)
+	}
+}
+
+// Returns a path in the dir for the file name that isn't taken, with a
+// numeric suffix before the extension if the name is.
+func freePath(dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 0; ; n++ {
+		p := filepath.Join(dir, name)
+		if n > 0 {
+			p = filepath.Join(dir, stem+"."+strconv.Itoa(n)+ext)
+		}
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			return p, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// Moves the file into the dir, copying it across filesystems. A file of the
+// same name in the dir is kept, the moved one gets a numeric suffix. Returns
+// the path of the moved file.
+func moveFile(fn, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return "", err
+	}
+	dst, err := freePath(dir, filepath.Base(fn))
+	if err != nil {
+		return "", err
+	}
+	if os.Rename(fn, dst) == nil {
+		return dst, nil
+	}
+	r, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, os.Remove(fn)
+}
+
+// Reports whether the file name matches the ignored temp file patterns.
+func ignoredFile(fn string) bool {
+	base := filepath.Base(fn)
+	for _, p := range strings.Split(args.IgnoreFiles, ";") {
+		if ok, _ := filepath.Match(strings.TrimSpace(p), base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Loads the .torrent file once it's completely written. A file that parses
+// is complete, as one that appeared by an atomic rename. Otherwise it may be
+// still written, so loading is retried with backoff, each time after the
+// size and the modification time of the file are stable.
+func loadStable(fn string, done chan bool) (*metainfo.MetaInfo, error) {
+	delay := args.IngestWait
+	for i := 0; ; i++ {
+		mi, err := metainfo.LoadFromFile(fn)
+		if err == nil {
+			_, err = mi.UnmarshalInfo()
+		}
+		if err == nil || os.IsNotExist(err) || i == args.IngestRetries {
+			return mi, err
+		}
+		if !waitStable(fn, delay, done) {
+			return nil, errIngestCanceled
+		}
+		delay *= 2
+	}
+}
+
+var errIngestCanceled = errors.New("ingest canceled")
+
+// Waits until the file doesn't change for the interval. Returns false if done.
+func waitStable(fn string, interval time.Duration, done chan bool) bool {
+	last, _ := os.Stat(fn)
+	for {
+		select {
+		case <-done:
+			return false
+		case <-time.After(interval):
+		}
+		fi, err := os.Stat(fn)
+		if err != nil || last != nil && fi.Size() == last.Size() && fi.ModTime().Equal(last.ModTime()) {
+			return true
+		}
+		last = fi
+	}
+}
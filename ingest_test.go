@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveFileCollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torrentfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "archive")
+	for i, want := range []string{"a.torrent", "a.1.torrent", "a.2.torrent"} {
+		fn := filepath.Join(dir, "a.torrent")
+		if err := ioutil.WriteFile(fn, []byte{byte(i)}, 0660); err != nil {
+			t.Fatal(err)
+		}
+		dst, err := moveFile(fn, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dst != filepath.Join(archive, want) {
+			t.Errorf("moved to %s, want %s", dst, want)
+		}
+	}
+	for i, name := range []string{"a.torrent", "a.1.torrent", "a.2.torrent"} {
+		b, err := ioutil.ReadFile(filepath.Join(archive, name))
+		if err != nil || len(b) != 1 || b[0] != byte(i) {
+			t.Errorf("%s: %v, %v", name, b, err)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+#!/bin/bash
+# Applies the patches of vendored packages in order. Run it after dep ensure,
+# which replaces the vendor dir with the upstream sources.
+
+cd "$(dirname "$0")/.."
+for p in patches/*.patch; do
+	git apply -v "$p" || exit 1
+done
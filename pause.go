@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Pauses a torrent by hash, keeping it in the client with its completion,
+// and resumes it back to the queue. Peers of a downloading torrent are
+// disconnected on pause with disconnect=1.
+func handlePause(chq chan *torrent.Torrent, wg *sync.WaitGroup, done chan bool) {
+	http.HandleFunc("/pause", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		e := ttreg.find(req.FormValue("hash"))
+		if e == nil {
+			http.Error(w, "no torrents found", http.StatusNotFound)
+			return
+		}
+		log.Printf("pause %s", e.t.Name())
+		e.setPaused(req.FormValue("disconnect") != "")
+		http.Redirect(w, req, "/", http.StatusSeeOther)
+	})
+
+	http.HandleFunc("/resume", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		e := ttreg.find(req.FormValue("hash"))
+		if e == nil {
+			http.Error(w, "no torrents found", http.StatusNotFound)
+			return
+		}
+		log.Printf("resume %s", e.t.Name())
+		if e.resume() {
+			requeue(e.t, 0, chq, wg, done)
+		}
+		http.Redirect(w, req, "/", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/iplist"
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Ips banned at runtime, over the blocklist of BannedFile.
+type banList struct {
+	base iplist.Ranger
+
+	mu  sync.RWMutex
+	ips map[string]bool
+}
+
+var bans = &banList{ips: make(map[string]bool)}
+
+func (bl *banList) Lookup(ip net.IP) (iplist.Range, bool) {
+	bl.mu.RLock()
+	banned := bl.ips[ip.String()]
+	bl.mu.RUnlock()
+	if banned {
+		return iplist.Range{First: ip, Last: ip, Description: "banned"}, true
+	}
+	if bl.base == nil {
+		return iplist.Range{}, false
+	}
+	return bl.base.Lookup(ip)
+}
+
+func (bl *banList) NumRanges() int {
+	bl.mu.RLock()
+	n := len(bl.ips)
+	bl.mu.RUnlock()
+	if bl.base != nil {
+		n += bl.base.NumRanges()
+	}
+	return n
+}
+
+func (bl *banList) ban(ip net.IP) {
+	bl.mu.Lock()
+	bl.ips[ip.String()] = true
+	bl.mu.Unlock()
+}
+
+// Sets max established peer conns of the torrent, kept for resume if its
+// peers are disconnected on pause.
+func (e *ttEntry) setMaxConns(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.maxConns > 0 {
+		e.maxConns = n
+		return
+	}
+	e.t.SetMaxEstablishedConns(n)
+}
+
+// Parses ip:port into a peer.
+func parsePeer(s string) (p torrent.Peer, err error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return
+	}
+	if p.IP = net.ParseIP(host); p.IP == nil {
+		return p, fmt.Errorf("bad ip %q", host)
+	}
+	if p.Port, err = strconv.Atoi(port); err != nil || p.Port <= 0 || p.Port > 0xffff {
+		return p, fmt.Errorf("bad port %q", port)
+	}
+	return
+}
+
+// Lists peers of a running torrent by hash. Before that, adds the add
+// ip:port peers, bans the ban ips in all torrents and sets max established
+// conns of the torrent to maxconns.
+func handlePeers(client *torrent.Client) {
+	http.HandleFunc("/peers", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req.ParseForm()
+		e := ttreg.find(req.FormValue("hash"))
+		if e == nil {
+			http.Error(w, "no torrents found", http.StatusNotFound)
+			return
+		}
+		var ps []torrent.Peer
+		for _, s := range req.Form["add"] {
+			p, err := parsePeer(s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ps = append(ps, p)
+		}
+		var ips []net.IP
+		for _, s := range req.Form["ban"] {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				http.Error(w, fmt.Sprintf("bad ip %q", s), http.StatusBadRequest)
+				return
+			}
+			ips = append(ips, ip)
+		}
+		max := -1
+		if s := req.FormValue("maxconns"); s != "" {
+			var err error
+			if max, err = strconv.Atoi(s); err != nil || max < 0 {
+				http.Error(w, fmt.Sprintf("bad maxconns %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+		for _, ip := range ips {
+			bans.ban(ip)
+			n := 0
+			for _, t := range client.Torrents() {
+				n += t.DropPeerIP(ip)
+			}
+			log.Printf("ban %s, dropped %d conns", ip, n)
+		}
+		if len(ps) > 0 {
+			log.Printf("add %d peers to %s", len(ps), e.t.Name())
+			e.t.AddPeers(ps)
+		}
+		if max >= 0 {
+			log.Printf("max conns of %s: %d", e.t.Name(), max)
+			e.setMaxConns(max)
+		}
+		for _, pc := range e.t.PeerConns() {
+			dir := "in"
+			if pc.Outgoing {
+				dir = "out"
+			}
+			src := pc.Source
+			if src == "" {
+				src = "-"
+			}
+			fmt.Fprintf(w, "%s %s %s %s %q %s down %s up %s\n", pc.Addr, dir, src, connEncryption(pc), pc.ClientName, pc.Completed,
+				humanize.Bytes(uint64(pc.Downloaded)), humanize.Bytes(uint64(pc.Uploaded)))
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Parses the proxy url, nil if it's empty. Only the schemes are allowed.
+func parseProxy(s string, schemes ...string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, sc := range schemes {
+		if u.Scheme == sc && u.Host != "" {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("proxy %q: want a %v url", s, schemes)
+}
+
+// Returns the proxy url, the default one if it's empty.
+func proxyOr(s string) string {
+	if s == "" {
+		return args.Proxy
+	}
+	return s
+}
+
+// Returns a transport of the default settings through the proxy.
+func proxyTransport(u *url.URL) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = http.ProxyURL(u)
+	return tr
+}
+
+// Sets proxies of peer conns and tracker announces of the client and those
+// of fetching urls.
+func setProxies(cfg *torrent.ClientConfig) error {
+	pu, err := parseProxy(proxyOr(args.PeerProxy), "socks5")
+	if err != nil {
+		return fmt.Errorf("peer %s", err)
+	}
+	tu, err := parseProxy(proxyOr(args.TrackerProxy), "socks5", "http", "https")
+	if err != nil {
+		return fmt.Errorf("tracker %s", err)
+	}
+	fu, err := parseProxy(proxyOr(args.FetchProxy), "socks5", "http", "https")
+	if err != nil {
+		return fmt.Errorf("fetch %s", err)
+	}
+	if pu != nil {
+		log.Printf("peer conns through %s\n", pu.Host)
+		cfg.ProxyURL = pu.String()
+	}
+	if tu != nil {
+		log.Printf("tracker announces through %s\n", tu.Host)
+		cfg.TrackerHTTPProxy = http.ProxyURL(tu)
+	}
+	if fu != nil {
+		log.Printf("fetching urls through %s\n", fu.Host)
+		fetchClient.Transport = proxyTransport(fu)
+		webSeedClient.Transport = proxyTransport(fu)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Serves a socks5 conn of no auth and the connect command, sending the
+// address connected to on addrs.
+func serveSocks(c net.Conn, addrs chan<- string) {
+	defer c.Close()
+	b := make([]byte, 256)
+	if _, err := io.ReadFull(c, b[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(c, b[:b[1]]); err != nil {
+		return
+	}
+	if _, err := c.Write([]byte{5, 0}); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(c, b[:4]); err != nil || b[1] != 1 {
+		return
+	}
+	var host string
+	switch b[3] {
+	case 1, 4:
+		n := 4
+		if b[3] == 4 {
+			n = 16
+		}
+		if _, err := io.ReadFull(c, b[:n]); err != nil {
+			return
+		}
+		host = net.IP(b[:n]).String()
+	case 3:
+		if _, err := io.ReadFull(c, b[:1]); err != nil {
+			return
+		}
+		n := int(b[0])
+		if _, err := io.ReadFull(c, b[:n]); err != nil {
+			return
+		}
+		host = string(b[:n])
+	default:
+		return
+	}
+	if _, err := io.ReadFull(c, b[:2]); err != nil {
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(b[0])<<8|int(b[1])))
+	select {
+	case addrs <- addr:
+	default:
+	}
+	tc, err := net.Dial("tcp", addr)
+	if err != nil {
+		c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer tc.Close()
+	if _, err := c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+	go io.Copy(tc, c)
+	io.Copy(c, tc)
+}
+
+// Starts a socks5 proxy sending the addresses connected through it on addrs.
+func startSocks(t *testing.T, addrs chan<- string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSocks(c, addrs)
+		}
+	}()
+	return ln
+}
+
+func TestProxies(t *testing.T) {
+	addrs := make(chan string, 100)
+	ln := startSocks(t, addrs)
+	defer ln.Close()
+
+	oldProxy, oldFetch, oldWebSeed := args.Proxy, fetchClient.Transport, webSeedClient.Transport
+	defer func() {
+		args.Proxy, fetchClient.Transport, webSeedClient.Transport = oldProxy, oldFetch, oldWebSeed
+	}()
+	args.Proxy = "socks5://" + ln.Addr().String()
+
+	dir, err := ioutil.TempDir("", "torrentfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := torrent.NewDefaultClientConfig()
+	if err := setProxies(cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = dir
+	cfg.DefaultStorage = storage.NewMMap(dir)
+	cfg.NoDHT = true
+	cfg.DisableUTP = true
+	cfg.DisableIPv6 = true
+	cfg.SetListenAddr("127.0.0.1:0")
+
+	fsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "fetched")
+	}))
+	defer fsrv.Close()
+	tsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "d8:intervali1800e5:peers0:e")
+	}))
+	defer tsrv.Close()
+	peer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	go func() {
+		for {
+			c, err := peer.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	want := map[string]string{
+		fsrv.Listener.Addr().String(): "fetch",
+		tsrv.Listener.Addr().String(): "tracker announce",
+		peer.Addr().String():          "peer dial",
+	}
+
+	resp, err := fetch(fsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(b) != "fetched" {
+		t.Fatalf("fetched %q, %v", b, err)
+	}
+
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	tt, _, err := client.AddTorrentSpec(&torrent.TorrentSpec{
+		InfoHash: metainfo.NewHashFromHex("9614f9db395f336572ffd499d67cada764e35b5c"),
+		Trackers: [][]string{{tsrv.URL + "/announce"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pa := peer.Addr().(*net.TCPAddr)
+	tt.AddPeers([]torrent.Peer{{IP: pa.IP, Port: pa.Port}})
+
+	timeout := time.After(10 * time.Second)
+	for len(want) > 0 {
+		select {
+		case a := <-addrs:
+			delete(want, a)
+		case <-timeout:
+			for _, what := range want {
+				t.Errorf("no %s through the proxy", what)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/tagflag"
+	"github.com/anacrolix/torrent/metainfo"
+	humanize "github.com/dustin/go-humanize"
+	"golang.org/x/time/rate"
+)
+
+// Upload and download limiters whose rates can be changed at runtime. -1
+// is unlimited.
+type rates struct {
+	up, down *rate.Limiter
+
+	mu               sync.Mutex
+	upRate, downRate tagflag.Bytes
+}
+
+func newRates(upBurst, downBurst int) *rates {
+	return &rates{
+		up:       rate.NewLimiter(rate.Inf, upBurst),
+		down:     rate.NewLimiter(rate.Inf, downBurst),
+		upRate:   -1,
+		downRate: -1,
+	}
+}
+
+func bytesLimit(rt tagflag.Bytes) rate.Limit {
+	if rt == -1 {
+		return rate.Inf
+	}
+	return rate.Limit(rt)
+}
+
+// Parses a rate in bytes per second, -1 for unlimited.
+func parseRate(s string) (rt tagflag.Bytes, err error) {
+	if s == "-1" {
+		return -1, nil
+	}
+	err = rt.Marshal(s)
+	return
+}
+
+func (r *rates) set(up, down tagflag.Bytes) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if up != r.upRate {
+		r.upRate = up
+		r.up.SetLimit(bytesLimit(up))
+	}
+	if down != r.downRate {
+		r.downRate = down
+		r.down.SetLimit(bytesLimit(down))
+	}
+}
+
+func (r *rates) get() (up, down tagflag.Bytes) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.upRate, r.downRate
+}
+
+func rateString(rt tagflag.Bytes) string {
+	if rt == -1 {
+		return "unlimited"
+	}
+	return humanize.Bytes(uint64(rt)) + "/s"
+}
+
+func (r *rates) String() string {
+	up, down := r.get()
+	return fmt.Sprintf("up %s, down %s", rateString(up), rateString(down))
+}
+
+// Rates of the client, under which are those of watch dirs and categories,
+// under which are those of torrents.
+var globalRates = newRates(256<<10, 1<<20)
+
+// Global rates set by flags or the api, in effect outside schedule windows.
+var baseRates struct {
+	mu       sync.Mutex
+	up, down tagflag.Bytes
+}
+
+// Global rates in a time of day, from to to, wrapping around midnight if
+// to is before from.
+type rateWindow struct {
+	from, to       time.Duration
+	up, down       tagflag.Bytes
+	hasUp, hasDown bool
+}
+
+var rateSchedule []rateWindow
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Parses windows separated by semicolon, each in the form
+// HH:MM-HH:MM?up=rate&down=rate.
+func parseRateSchedule(s string) (ret []rateWindow, err error) {
+	for _, w := range strings.Split(s, ";") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		var rw rateWindow
+		span, settings := w, ""
+		if i := strings.IndexByte(w, '?'); i >= 0 {
+			span, settings = w[:i], w[i+1:]
+		}
+		i := strings.IndexByte(span, '-')
+		if i < 0 {
+			return nil, fmt.Errorf("rate window %q: no time span", w)
+		}
+		if rw.from, err = parseClock(span[:i]); err != nil {
+			return nil, fmt.Errorf("rate window %q: %s", w, err)
+		}
+		if rw.to, err = parseClock(span[i+1:]); err != nil {
+			return nil, fmt.Errorf("rate window %q: %s", w, err)
+		}
+		q, err := url.ParseQuery(settings)
+		if err != nil {
+			return nil, fmt.Errorf("rate window %q: %s", w, err)
+		}
+		for k, vs := range q {
+			v := vs[len(vs)-1]
+			switch k {
+			case "up":
+				rw.up, err = parseRate(v)
+				rw.hasUp = true
+			case "down":
+				rw.down, err = parseRate(v)
+				rw.hasDown = true
+			default:
+				err = fmt.Errorf("unknown setting %q", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rate window %q: %s", w, err)
+			}
+		}
+		ret = append(ret, rw)
+	}
+	return
+}
+
+func (rw rateWindow) contains(now time.Time) bool {
+	y, m, d := now.Date()
+	at := now.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+	if rw.from <= rw.to {
+		return at >= rw.from && at < rw.to
+	}
+	return at >= rw.from || at < rw.to
+}
+
+// Returns the first schedule window containing now.
+func activeRateWindow(now time.Time) *rateWindow {
+	for i := range rateSchedule {
+		if rateSchedule[i].contains(now) {
+			return &rateSchedule[i]
+		}
+	}
+	return nil
+}
+
+// Sets the global rates from the base rates and the schedule window in
+// effect at now.
+func applyGlobalRates(now time.Time) {
+	baseRates.mu.Lock()
+	up, down := baseRates.up, baseRates.down
+	baseRates.mu.Unlock()
+	if rw := activeRateWindow(now); rw != nil {
+		if rw.hasUp {
+			up = rw.up
+		}
+		if rw.hasDown {
+			down = rw.down
+		}
+	}
+	if oup, odown := globalRates.get(); oup != up || odown != down {
+		log.Printf("global rates: up %s, down %s", rateString(up), rateString(down))
+		globalRates.set(up, down)
+	}
+}
+
+func setBaseRates(up, down tagflag.Bytes) {
+	baseRates.mu.Lock()
+	baseRates.up, baseRates.down = up, down
+	baseRates.mu.Unlock()
+	applyGlobalRates(time.Now())
+}
+
+// Applies the rate schedule each minute until done is closed.
+func runRateSchedule(done chan bool) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Minute - time.Duration(time.Now().Second())*time.Second):
+			applyGlobalRates(time.Now())
+		}
+	}
+}
+
+// Rates of torrents by info hash, unlimited until set.
+var torrentRates = struct {
+	mu sync.Mutex
+	m  map[metainfo.Hash]*rates
+}{m: make(map[metainfo.Hash]*rates)}
+
+func torrentRatesOf(ih metainfo.Hash) *rates {
+	torrentRates.mu.Lock()
+	defer torrentRates.mu.Unlock()
+	r, ok := torrentRates.m[ih]
+	if !ok {
+		r = newRates(1<<20, 1<<20)
+		torrentRates.m[ih] = r
+	}
+	return r
+}
+
+func torrentDownLimiter(ih metainfo.Hash) *rate.Limiter {
+	return torrentRatesOf(ih).down
+}
+
+func dropTorrentRates(ih metainfo.Hash) {
+	torrentRates.mu.Lock()
+	delete(torrentRates.m, ih)
+	torrentRates.mu.Unlock()
+}
+
+// Parses the up and down form values over the current rates.
+func formRates(req *http.Request, up, down tagflag.Bytes) (tagflag.Bytes, tagflag.Bytes, bool, error) {
+	set := false
+	for _, f := range []struct {
+		k  string
+		rt *tagflag.Bytes
+	}{{"up", &up}, {"down", &down}} {
+		if v := req.FormValue(f.k); v != "" {
+			rt, err := parseRate(v)
+			if err != nil {
+				return up, down, false, fmt.Errorf("%s: %s", f.k, err)
+			}
+			*f.rt = rt
+			set = true
+		}
+	}
+	return up, down, set, nil
+}
+
+func writeRates(w io.Writer, wds *watchDirs) {
+	fmt.Fprintf(w, "global: %s", globalRates)
+	if activeRateWindow(time.Now()) != nil {
+		fmt.Fprint(w, " (scheduled)")
+	}
+	fmt.Fprintln(w)
+	for _, wd := range wds.list() {
+		if wd.Category == "" {
+			fmt.Fprintf(w, "dir %s: %s\n", wd.Dir, wd.rates)
+		}
+	}
+	cs := make([]string, 0, len(cats.conf))
+	for c := range cats.conf {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	for _, c := range cs {
+		fmt.Fprintf(w, "category %s: %s\n", c, cats.conf[c].rates)
+	}
+	for _, e := range ttreg.list() {
+		fmt.Fprintf(w, "torrent %s %s: %s\n", e.t.InfoHash().HexString(), e.t.Name(), torrentRatesOf(e.t.InfoHash()))
+	}
+}
+
+// Sets the up and down rates of a torrent by hash, of a watch dir, of a
+// category or, without any of them, the global ones, and lists all rates.
+func handleRates(wds *watchDirs) {
+	http.HandleFunc("/rates", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var rs []*rates
+		var what string
+		switch {
+		case req.FormValue("hash") != "":
+			e := ttreg.find(req.FormValue("hash"))
+			if e == nil {
+				http.Error(w, "no torrents found", http.StatusNotFound)
+				return
+			}
+			rs, what = []*rates{torrentRatesOf(e.t.InfoHash())}, e.t.Name()
+		case req.FormValue("dir") != "":
+			for _, wd := range wds.list() {
+				if wd.Category == "" && wd.Dir == req.FormValue("dir") {
+					rs, what = []*rates{wd.rates}, wd.Dir
+				}
+			}
+		case req.FormValue("category") != "":
+			if cd, ok := cats.conf[req.FormValue("category")]; ok {
+				rs, what = []*rates{cd.rates}, "category "+cd.Category
+			}
+		}
+		if rs == nil && (req.FormValue("dir") != "" || req.FormValue("category") != "") {
+			http.Error(w, "no dirs found", http.StatusNotFound)
+			return
+		}
+		var up, down tagflag.Bytes
+		if rs == nil {
+			baseRates.mu.Lock()
+			up, down = baseRates.up, baseRates.down
+			baseRates.mu.Unlock()
+		} else {
+			up, down = rs[0].get()
+		}
+		up, down, set, err := formRates(req, up, down)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if set {
+			if rs == nil {
+				log.Printf("set global rates: up %s, down %s", rateString(up), rateString(down))
+				setBaseRates(up, down)
+			}
+			if rs != nil {
+				log.Printf("set rates of %s: up %s, down %s", what, rateString(up), rateString(down))
+			}
+			for _, r := range rs {
+				r.set(up, down)
+			}
+		}
+		writeRates(w, wds)
+	})
+}
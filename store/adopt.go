@@ -0,0 +1,103 @@
+package store
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"golang.org/x/time/rate"
+)
+
+// How the existing data of a torrent file matched its pieces.
+type FileMatch struct {
+	Path   string // Where the data was found.
+	Pieces int
+	Ok     int
+	Placed bool // The data was moved or linked into the storage dir.
+}
+
+// Adopts existing torrent data without downloading it. Files are looked up by
+// the locator, or in dir if it's nil, and verified against the pieces of the
+// info. Files found elsewhere with at least one good piece are placed into
+// dir, by moving them or hard linking (falling back to copying). Verified
+// pieces are marked complete in the piece completion. Returns a match of each
+// file, in the order of info.UpvertedFiles.
+func Adopt(dir string, pc PieceCompletion, info *metainfo.Info, infoHash metainfo.Hash, locate FileLocator, move bool, workers int, lim *rate.Limiter) (ret []FileMatch, err error) {
+	if locate == nil {
+		locate = func(info *metainfo.Info, fi metainfo.FileInfo) string {
+			return filepath.Join(append([]string{dir, info.Name}, fi.Path...)...)
+		}
+	}
+	ok, err := Verify(NewFileWithLocator(locate, NewMapPieceCompletion()), info, infoHash, workers, lim)
+	if err != nil {
+		return
+	}
+	var off int64
+	for _, fi := range info.UpvertedFiles() {
+		fm := FileMatch{Path: locate(info, fi)}
+		if fi.Length != 0 {
+			begin := int(off / info.PieceLength)
+			end := int((off + fi.Length - 1) / info.PieceLength)
+			fm.Pieces = end - begin + 1
+			for i := begin; i <= end; i++ {
+				if ok[i] {
+					fm.Ok++
+				}
+			}
+		}
+		off += fi.Length
+		name := filepath.Join(append([]string{dir, info.Name}, fi.Path...)...)
+		if fm.Ok > 0 && fm.Path != name {
+			err = placeFile(fm.Path, name, move)
+			if err != nil {
+				return
+			}
+			fm.Placed = true
+		}
+		ret = append(ret, fm)
+	}
+	for i, c := range ok {
+		err = pc.Set(metainfo.PieceKey{InfoHash: infoHash, Index: i}, c)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Replaces dst with src.
+func placeFile(src, dst string, move bool) (err error) {
+	os.MkdirAll(filepath.Dir(dst), 0770)
+	os.Remove(dst)
+	if move {
+		err = os.Rename(src, dst)
+	} else {
+		err = os.Link(src, dst)
+	}
+	if err == nil {
+		return
+	}
+	err = copyFile(src, dst)
+	if err == nil && move {
+		err = os.Remove(src)
+	}
+	return
+}
+
+func copyFile(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Storage backends selectable for a dir.
+const (
+	BackendFile   = "file"
+	BackendMMap   = "mmap"
+	BackendMemory = "memory"
+	BackendBolt   = "bolt"
+)
+
+// Opens the storage backend for the dir. All backends track the completion
+// of pieces with the given completion, shared by the torrents of the dir.
+// Neither the storage nor its torrents close it, the caller closes it once
+// after the storage.
+func Open(backend, dir string, completion PieceCompletion) (storage.ClientImpl, error) {
+	completion = unclosedPieceCompletion{completion}
+	switch backend {
+	case "", BackendFile:
+		return NewFileWithCompletion(dir, completion), nil
+	case BackendMMap:
+		return storage.NewMMapWithCompletion(dir, completion), nil
+	case BackendMemory:
+		return NewMemory(completion), nil
+	case BackendBolt:
+		cl, err := newBoltDB(dir)
+		if err != nil {
+			return nil, err
+		}
+		return WithCompletion(cl, completion), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
+
+// Completion whose Close does nothing, as torrent storage like mmap closes
+// its completion with each torrent.
+type unclosedPieceCompletion struct {
+	PieceCompletion
+}
+
+func (unclosedPieceCompletion) Close() error {
+	return nil
+}
+
+func (me unclosedPieceCompletion) Health() error {
+	if hc, ok := me.PieceCompletion.(HealthChecker); ok {
+		return hc.Health()
+	}
+	return nil
+}
+
+// Pieces stored in bolt.db of the dir.
+func newBoltDB(dir string) (ret storage.ClientImpl, err error) {
+	os.MkdirAll(dir, 0770)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("couldn't open bolt storage in %q: %v", dir, r)
+		}
+	}()
+	ret = storage.NewBoltDB(dir)
+	return
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Closing a torrent of a dir keeps the completion of the others working.
+func TestCloseTorrentKeepsCompletion(t *testing.T) {
+	for _, backend := range []string{BackendFile, BackendMMap, BackendMemory} {
+		t.Run(backend, func(t *testing.T) {
+			// The bolt completion takes its dir relative to the working dir.
+			dir, err := ioutil.TempDir(".", "torrentfs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			pc, err := OpenPieceCompletion(dir, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pc.Close()
+			cl, err := Open(backend, dir, pc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+
+			open := func(name string) (*metainfo.Info, metainfo.Hash) {
+				info := &metainfo.Info{Name: name, PieceLength: 16, Pieces: make([]byte, 20), Length: 16}
+				return info, metainfo.HashBytes([]byte(name))
+			}
+			info1, ih1 := open("a")
+			t1, err := cl.OpenTorrent(info1, ih1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info2, ih2 := open("b")
+			t2, err := cl.OpenTorrent(info2, ih2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer t2.Close()
+			if err := t1.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			p := t2.Piece(info2.Piece(0))
+			if _, err := p.WriteAt(make([]byte, 16), 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.MarkComplete(); err != nil {
+				t.Fatalf("marking complete after another torrent closed: %s", err)
+			}
+			if c := p.Completion(); !c.Ok || !c.Complete {
+				t.Errorf("completion after another torrent closed: %+v", c)
+			}
+		})
+	}
+}
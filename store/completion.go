@@ -0,0 +1,72 @@
+package store
+
+import (
+	"log"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Storage that tracks the completion of pieces with the given completion,
+// instead of the one of the wrapped storage.
+type completionClientImpl struct {
+	storage.ClientImpl
+	pc PieceCompletion
+}
+
+func WithCompletion(cl storage.ClientImpl, completion PieceCompletion) storage.ClientImpl {
+	return &completionClientImpl{cl, completion}
+}
+
+func (me *completionClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	t, err := me.ClientImpl.OpenTorrent(info, infoHash)
+	if err != nil {
+		return nil, err
+	}
+	return &completionTorrentImpl{t, infoHash, me.pc}, nil
+}
+
+func (me *completionClientImpl) Close() error {
+	err := me.ClientImpl.Close()
+	if err1 := me.pc.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+type completionTorrentImpl struct {
+	storage.TorrentImpl
+	infoHash metainfo.Hash
+	pc       PieceCompletion
+}
+
+func (me *completionTorrentImpl) Piece(p metainfo.Piece) storage.PieceImpl {
+	return &completionPieceImpl{
+		me.TorrentImpl.Piece(p),
+		metainfo.PieceKey{InfoHash: me.infoHash, Index: p.Index()},
+		me.pc,
+	}
+}
+
+type completionPieceImpl struct {
+	storage.PieceImpl
+	pk metainfo.PieceKey
+	pc PieceCompletion
+}
+
+func (me *completionPieceImpl) Completion() storage.Completion {
+	c, err := me.pc.Get(me.pk)
+	if err != nil {
+		log.Printf("error getting piece completion: %s", err)
+		c.Ok = false
+	}
+	return c
+}
+
+func (me *completionPieceImpl) MarkComplete() error {
+	return me.pc.Set(me.pk, true)
+}
+
+func (me *completionPieceImpl) MarkNotComplete() error {
+	return me.pc.Set(me.pk, false)
+}
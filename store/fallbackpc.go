@@ -0,0 +1,128 @@
+package store
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// How often a detached piece completion retries opening its bolt db.
+var CompletionRetryInterval = 30 * time.Second
+
+// Reports whether a storage or a piece completion is persisting state as
+// expected. A nil error means healthy.
+type HealthChecker interface {
+	Health() error
+}
+
+// Piece completion that keeps state in memory while the bolt db of the dir
+// can't be opened (for example, it's locked by another process), and
+// re-attaches to the db once it becomes available.
+type fallbackPieceCompletion struct {
+	dir    string
+	mu     sync.RWMutex
+	pc     PieceCompletion
+	err    error
+	closed chan struct{}
+	once   sync.Once
+}
+
+var _ PieceCompletion = (*fallbackPieceCompletion)(nil)
+
+// Opens the piece completion db for the dir. In strict mode a failure to open
+// the bolt db is returned as an error. Otherwise the in-memory completion is
+// used, the dir is reported unhealthy, and opening is retried in background.
+func OpenPieceCompletion(dir string, strict bool) (PieceCompletion, error) {
+	pc, err := NewBoltPieceCompletion(dir)
+	if err == nil {
+		return pc, nil
+	}
+	if strict {
+		return nil, err
+	}
+	log.Printf("couldn't open piece completion db in %q: %s", dir, err)
+	me := &fallbackPieceCompletion{
+		dir:    dir,
+		pc:     NewMapPieceCompletion(),
+		err:    err,
+		closed: make(chan struct{}),
+	}
+	go me.reattach()
+	return me, nil
+}
+
+func (me *fallbackPieceCompletion) reattach() {
+	tck := time.NewTicker(CompletionRetryInterval)
+	defer tck.Stop()
+	for {
+		select {
+		case <-me.closed:
+			return
+		case <-tck.C:
+			pc, err := NewBoltPieceCompletion(me.dir)
+			if err != nil {
+				me.mu.Lock()
+				me.err = err
+				me.mu.Unlock()
+				continue
+			}
+			if me.attach(pc) {
+				log.Printf("piece completion db in %q attached", me.dir)
+			}
+			return
+		}
+	}
+}
+
+// Moves the state gathered in memory to the opened db and switches to it.
+func (me *fallbackPieceCompletion) attach(pc PieceCompletion) bool {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	select {
+	case <-me.closed:
+		pc.Close()
+		return false
+	default:
+	}
+	mem := me.pc.(*mapPieceCompletion)
+	mem.mu.Lock()
+	for pk, b := range mem.m {
+		if err := pc.Set(pk, b); err != nil {
+			log.Printf("error moving piece completion to db in %q: %s", me.dir, err)
+		}
+	}
+	mem.mu.Unlock()
+	me.pc = pc
+	me.err = nil
+	return true
+}
+
+func (me *fallbackPieceCompletion) Health() error {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.err
+}
+
+func (me *fallbackPieceCompletion) Get(pk metainfo.PieceKey) (storage.Completion, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.pc.Get(pk)
+}
+
+func (me *fallbackPieceCompletion) Set(pk metainfo.PieceKey, b bool) error {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.pc.Set(pk, b)
+}
+
+func (me *fallbackPieceCompletion) Close() error {
+	me.once.Do(func() {
+		close(me.closed)
+	})
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.pc.Close()
+}
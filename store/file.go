@@ -2,7 +2,6 @@ package store
 
 import (
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 
@@ -23,11 +22,7 @@ type PieceCompletion interface {
 }
 
 func pieceCompletionForDir(dir string) (ret PieceCompletion) {
-	ret, err := NewBoltPieceCompletion(dir)
-	if err != nil {
-		log.Printf("couldn't open piece completion db in %q: %s", dir, err)
-		ret = NewMapPieceCompletion()
-	}
+	ret, _ = OpenPieceCompletion(dir, false)
 	return
 }
 
@@ -36,9 +31,13 @@ func pieceCompletionForDir(dir string) (ret PieceCompletion) {
 type fileClientImpl struct {
 	baseDir   string
 	pathMaker func(baseDir string, info *metainfo.Info, infoHash metainfo.Hash) string
+	locate    FileLocator
 	pc        PieceCompletion
 }
 
+// Returns the native path of a file of the torrent.
+type FileLocator func(info *metainfo.Info, fi metainfo.FileInfo) string
+
 // The Default path maker just returns the current path
 func defaultPathMaker(baseDir string, info *metainfo.Info, infoHash metainfo.Hash) string {
 	return baseDir
@@ -67,6 +66,15 @@ func NewFileWithCustomPathMaker(baseDir string, pathMaker func(baseDir string, i
 	return newFileWithCustomPathMakerAndCompletion(baseDir, pathMaker, pieceCompletionForDir(baseDir))
 }
 
+// File storage with each file of a torrent at the path given by the locator.
+func NewFileWithLocator(locate FileLocator, completion PieceCompletion) storage.ClientImpl {
+	return &fileClientImpl{
+		pathMaker: defaultPathMaker,
+		locate:    locate,
+		pc:        completion,
+	}
+}
+
 func newFileWithCustomPathMakerAndCompletion(baseDir string, pathMaker func(baseDir string, info *metainfo.Info, infoHash metainfo.Hash) string, completion PieceCompletion) storage.ClientImpl {
 	if pathMaker == nil {
 		pathMaker = defaultPathMaker
@@ -82,16 +90,26 @@ func (me *fileClientImpl) Close() error {
 	return me.pc.Close()
 }
 
+func (me *fileClientImpl) Health() error {
+	if hc, ok := me.pc.(HealthChecker); ok {
+		return hc.Health()
+	}
+	return nil
+}
+
 func (fs *fileClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
 	dir := fs.pathMaker(fs.baseDir, info, infoHash)
-	err := CreateNativeZeroLengthFiles(info, dir)
-	if err != nil {
-		return nil, err
+	if fs.locate == nil {
+		err := CreateNativeZeroLengthFiles(info, dir)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &fileTorrentImpl{
 		dir,
 		info,
 		infoHash,
+		fs.locate,
 		fs.pc,
 	}, nil
 }
@@ -100,6 +118,7 @@ type fileTorrentImpl struct {
 	dir        string
 	info       *metainfo.Info
 	infoHash   metainfo.Hash
+	locate     FileLocator
 	completion PieceCompletion
 }
 
@@ -236,5 +255,8 @@ func (fst fileTorrentImplIO) WriteAt(p []byte, off int64) (n int, err error) {
 }
 
 func (fts *fileTorrentImpl) fileInfoName(fi metainfo.FileInfo) string {
+	if fts.locate != nil {
+		return fts.locate(fts.info, fi)
+	}
 	return filepath.Join(append([]string{fts.dir, fts.info.Name}, fi.Path...)...)
 }
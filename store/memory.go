@@ -0,0 +1,123 @@
+package store
+
+import (
+	"io"
+	"log"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// In-memory storage, mostly for tests and benchmarks. Data is lost on close,
+// so the completion given shouldn't outlive it.
+type memClientImpl struct {
+	mu sync.Mutex
+	ts map[metainfo.Hash]*memTorrentImpl
+	pc PieceCompletion
+}
+
+func NewMemory(completion PieceCompletion) storage.ClientImpl {
+	return &memClientImpl{
+		ts: make(map[metainfo.Hash]*memTorrentImpl),
+		pc: completion,
+	}
+}
+
+func (me *memClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	t, ok := me.ts[infoHash]
+	if !ok {
+		t = &memTorrentImpl{
+			infoHash: infoHash,
+			pieces:   make(map[int][]byte),
+			pc:       me.pc,
+		}
+		me.ts[infoHash] = t
+	}
+	return t, nil
+}
+
+func (me *memClientImpl) Close() error {
+	me.mu.Lock()
+	me.ts = nil
+	me.mu.Unlock()
+	return me.pc.Close()
+}
+
+type memTorrentImpl struct {
+	infoHash metainfo.Hash
+	mu       sync.RWMutex
+	pieces   map[int][]byte
+	pc       PieceCompletion
+}
+
+func (me *memTorrentImpl) Piece(p metainfo.Piece) storage.PieceImpl {
+	return &memPieceImpl{me, p}
+}
+
+func (me *memTorrentImpl) Close() error {
+	return nil
+}
+
+type memPieceImpl struct {
+	t *memTorrentImpl
+	p metainfo.Piece
+}
+
+var _ storage.PieceImpl = (*memPieceImpl)(nil)
+
+func (me *memPieceImpl) pieceKey() metainfo.PieceKey {
+	return metainfo.PieceKey{InfoHash: me.t.infoHash, Index: me.p.Index()}
+}
+
+// Returns EOF if the piece wasn't written that far.
+func (me *memPieceImpl) ReadAt(b []byte, off int64) (n int, err error) {
+	me.t.mu.RLock()
+	defer me.t.mu.RUnlock()
+	data := me.t.pieces[me.p.Index()]
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n = copy(b, data[off:])
+	if n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (me *memPieceImpl) WriteAt(b []byte, off int64) (n int, err error) {
+	me.t.mu.Lock()
+	defer me.t.mu.Unlock()
+	data, ok := me.t.pieces[me.p.Index()]
+	if !ok {
+		data = make([]byte, me.p.Length())
+		me.t.pieces[me.p.Index()] = data
+	}
+	if off >= int64(len(data)) {
+		return 0, io.ErrShortWrite
+	}
+	n = copy(data[off:], b)
+	if n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return
+}
+
+func (me *memPieceImpl) Completion() storage.Completion {
+	c, err := me.t.pc.Get(me.pieceKey())
+	if err != nil {
+		log.Printf("error getting piece completion: %s", err)
+		c.Ok = false
+	}
+	return c
+}
+
+func (me *memPieceImpl) MarkComplete() error {
+	return me.t.pc.Set(me.pieceKey(), true)
+}
+
+func (me *memPieceImpl) MarkNotComplete() error {
+	return me.t.pc.Set(me.pieceKey(), false)
+}
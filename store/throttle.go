@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
+)
+
+// Storage that limits the rate of writing pieces, which is the rate of
+// downloading. Reads aren't limited, uploading to peers is limited by the
+// client, so that streaming and verifying aren't. Nil limiters don't limit.
+type throttledClientImpl struct {
+	storage.ClientImpl
+	lims func(infoHash metainfo.Hash) *rate.Limiter
+}
+
+func Throttled(cl storage.ClientImpl, down *rate.Limiter) storage.ClientImpl {
+	return ThrottledTorrents(cl, func(metainfo.Hash) *rate.Limiter {
+		return down
+	})
+}
+
+// Like Throttled, with the limiter of each torrent got by lims when it's
+// opened.
+func ThrottledTorrents(cl storage.ClientImpl, lims func(infoHash metainfo.Hash) *rate.Limiter) storage.ClientImpl {
+	return &throttledClientImpl{cl, lims}
+}
+
+func (me *throttledClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	t, err := me.ClientImpl.OpenTorrent(info, infoHash)
+	if err != nil {
+		return nil, err
+	}
+	return &throttledTorrentImpl{t, me.lims(infoHash)}, nil
+}
+
+type throttledTorrentImpl struct {
+	storage.TorrentImpl
+	down *rate.Limiter
+}
+
+func (me *throttledTorrentImpl) Piece(p metainfo.Piece) storage.PieceImpl {
+	return &throttledPieceImpl{me.TorrentImpl.Piece(p), me.down}
+}
+
+type throttledPieceImpl struct {
+	storage.PieceImpl
+	down *rate.Limiter
+}
+
+func (me *throttledPieceImpl) WriteAt(b []byte, off int64) (int, error) {
+	if me.down != nil {
+		waitN(me.down, len(b))
+	}
+	return me.PieceImpl.WriteAt(b, off)
+}
+
+// Waits for n tokens, which may exceed the burst.
+func waitN(lim *rate.Limiter, n int) {
+	for n > 0 {
+		m := n
+		if b := lim.Burst(); m > b {
+			m = b
+		}
+		lim.WaitN(context.Background(), m)
+		n -= m
+	}
+}
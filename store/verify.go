@@ -0,0 +1,97 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"io"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
+)
+
+const verifyReadSize = 256 << 10
+
+// Re-hashes every piece of the torrent in the storage against info.Pieces,
+// and marks each piece complete or not complete accordingly. Pieces are
+// hashed by the given number of workers, reads are throttled by the limiter
+// if it isn't nil. Returns the completion of each piece.
+func Verify(sti storage.ClientImpl, info *metainfo.Info, infoHash metainfo.Hash, workers int, lim *rate.Limiter) (ret []bool, err error) {
+	ts, err := sti.OpenTorrent(info, infoHash)
+	if err != nil {
+		return
+	}
+	defer ts.Close()
+	if workers < 1 {
+		workers = 1
+	}
+	ret = make([]bool, info.NumPieces())
+	pieces := make(chan int)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+	)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range pieces {
+				p := info.Piece(i)
+				pi := ts.Piece(p)
+				ok := pieceHashOk(pi, p, lim)
+				ret[i] = ok
+				var err error
+				if ok {
+					err = pi.MarkComplete()
+				} else {
+					err = pi.MarkNotComplete()
+				}
+				if err != nil {
+					mu.Lock()
+					if first == nil {
+						first = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range ret {
+		pieces <- i
+	}
+	close(pieces)
+	wg.Wait()
+	err = first
+	return
+}
+
+// Missing or short data fails the check.
+func pieceHashOk(pi storage.PieceImpl, p metainfo.Piece, lim *rate.Limiter) bool {
+	h := sha1.New()
+	size := verifyReadSize
+	if lim != nil && lim.Burst() < size {
+		size = lim.Burst()
+	}
+	buf := make([]byte, size)
+	r := io.NewSectionReader(pi, 0, p.Length())
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if lim != nil {
+				lim.WaitN(context.Background(), n)
+			}
+			h.Write(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false
+		}
+	}
+	sum := p.Hash()
+	return bytes.Equal(h.Sum(nil), sum[:])
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Orders of downloading pieces.
+const (
+	// All pieces at once, in the order the client picks.
+	strategyRarest = "rarest"
+	// A window of pieces from the first missing one on.
+	strategySequential = "sequential"
+	// First and last pieces of each file, then all pieces.
+	strategyFirstLast = "firstlast"
+)
+
+func checkStrategy(s string) error {
+	switch s {
+	case strategyRarest, strategySequential, strategyFirstLast:
+		return nil
+	}
+	return fmt.Errorf("unknown download strategy %q", s)
+}
+
+// Pieces requested by a strategy so far.
+type strategyState struct {
+	name string
+	// Start of the sequential window, -1 until pieces are requested.
+	first int
+	// First and last pieces of files.
+	ends []int
+	// All pieces are requested.
+	all bool
+}
+
+// First and last pieces of the files of the torrent.
+func fileEnds(t *torrent.Torrent) (ret []int) {
+	pl := t.Info().PieceLength
+	seen := make(map[int]bool)
+	for _, f := range t.Files() {
+		if f.Length() == 0 {
+			continue
+		}
+		for _, i := range []int{int(f.Offset() / pl), int((f.Offset() + f.Length() - 1) / pl)} {
+			if !seen[i] {
+				seen[i] = true
+				ret = append(ret, i)
+			}
+		}
+	}
+	return
+}
+
+// Pieces of the torrent in the order the strategy wants them, for fetching
+// outside the client.
+func strategyOrder(t *torrent.Torrent, name string) []int {
+	n := t.NumPieces()
+	ret := make([]int, 0, n)
+	switch name {
+	case strategyFirstLast:
+		ends := fileEnds(t)
+		seen := make(map[int]bool)
+		for _, i := range ends {
+			seen[i] = true
+		}
+		ret = append(ret, ends...)
+		for i := 0; i < n; i++ {
+			if !seen[i] {
+				ret = append(ret, i)
+			}
+		}
+	default:
+		for i := 0; i < n; i++ {
+			ret = append(ret, i)
+		}
+		if name == strategyRarest {
+			if av := t.PieceAvailability(); av != nil {
+				sort.SliceStable(ret, func(i, j int) bool {
+					return av[ret[i]] < av[ret[j]]
+				})
+			}
+		}
+	}
+	return ret
+}
+
+// Requests pieces of the downloading torrent by the strategy.
+func (st *strategyState) apply(t *torrent.Torrent, name string) {
+	n := t.NumPieces()
+	if name != st.name {
+		if st.name != "" {
+			t.CancelPieces(0, n)
+		}
+		*st = strategyState{name: name, first: -1}
+	}
+	if st.all {
+		return
+	}
+	switch name {
+	case strategyRarest:
+		t.DownloadAll()
+		st.all = true
+	case strategySequential:
+		first := st.first
+		if first < 0 {
+			first = 0
+		}
+		for first < n && t.PieceState(first).Complete {
+			first++
+		}
+		if first == st.first {
+			return
+		}
+		win := int(args.SequentialWindow.Int64() / t.Info().PieceLength)
+		if win < 1 {
+			win = 1
+		}
+		end := first + win
+		if end > n {
+			end = n
+		}
+		if st.first < 0 {
+			t.CancelPieces(end, n)
+		}
+		t.DownloadPieces(first, end)
+		st.first = first
+	case strategyFirstLast:
+		if st.first < 0 {
+			st.ends = fileEnds(t)
+			t.CancelPieces(0, n)
+			for _, i := range st.ends {
+				t.DownloadPieces(i, i+1)
+			}
+			st.first = 0
+		}
+		for _, i := range st.ends {
+			if !t.PieceState(i).Complete {
+				return
+			}
+		}
+		t.DownloadAll()
+		st.all = true
+	}
+}
+
+// Requests pieces of the torrent by its strategy as pieces complete, until
+// it's complete or stop is closed.
+func runStrategy(e *ttEntry, stop <-chan struct{}) {
+	t := e.t
+	<-t.GotInfo()
+	sub := t.SubscribePieceStateChanges()
+	defer sub.Close()
+	var st strategyState
+	for t.BytesMissing() > 0 {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		st.apply(t, e.Strategy())
+		select {
+		case <-stop:
+			return
+		case <-sub.Values:
+		case <-e.strategyChanged:
+		}
+	}
+}
+
+// Strategy of a downloading torrent run in the background.
+type strategyRun struct {
+	stop, done chan struct{}
+	once       sync.Once
+}
+
+func startStrategy(e *ttEntry) *strategyRun {
+	r := &strategyRun{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		runStrategy(e, r.stop)
+	}()
+	return r
+}
+
+// Stops the run and waits for it, so that no pieces are requested after.
+func (r *strategyRun) halt() {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+// Sets the download strategy of a torrent by hash.
+func handleStrategy() {
+	http.HandleFunc("/strategy", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		e := ttreg.find(req.FormValue("hash"))
+		if e == nil {
+			http.Error(w, "no torrents found", http.StatusNotFound)
+			return
+		}
+		s := req.FormValue("set")
+		if err := checkStrategy(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("download %s by %s strategy", e.t.Name(), s)
+		e.setStrategy(s)
+		http.Redirect(w, req, "/", http.StatusSeeOther)
+	})
+}
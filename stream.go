@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Reads of a request are canceled with it.
+type ctxReader struct {
+	torrent.Reader
+	ctx context.Context
+}
+
+func (r ctxReader) Read(b []byte) (int, error) {
+	return r.ReadContext(r.ctx, b)
+}
+
+// Serves a file of a torrent at /stream/{infohash}/{path}, with the path as
+// in the torrent, with or without the torrent name. Ranges are read ahead
+// of, so the client downloads them first.
+func handleStream() {
+	http.HandleFunc("/stream/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rest := strings.TrimPrefix(req.URL.Path, "/stream/")
+		i := strings.IndexByte(rest, '/')
+		if i < 0 {
+			http.NotFound(w, req)
+			return
+		}
+		e := ttreg.find(rest[:i])
+		if e == nil {
+			http.Error(w, "no torrents found", http.StatusNotFound)
+			return
+		}
+		select {
+		case <-e.t.GotInfo():
+		case <-req.Context().Done():
+			return
+		}
+		fp := rest[i+1:]
+		var f *torrent.File
+		for _, tf := range e.t.Files() {
+			if tf.Path() == fp || tf.DisplayPath() == fp {
+				f = tf
+				break
+			}
+		}
+		if f == nil {
+			http.Error(w, "no such file in the torrent", http.StatusNotFound)
+			return
+		}
+		r := f.NewReader()
+		defer r.Close()
+		r.SetReadahead(args.StreamReadahead.Int64())
+		http.ServeContent(w, req, path.Base(f.DisplayPath()), time.Time{}, ctxReader{r, req.Context()})
+	})
+}
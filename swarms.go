@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/covrom/torrentfs/tracker"
+)
+
+// Embedded tracker, nil unless it's running.
+var lanTracker *tracker.Tracker
+
+// Runs the embedded tracker by HTTP and UDP on the address.
+func startTracker(addr string) error {
+	t := tracker.New(args.TrackerInterval)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	go func() {
+		log.Printf("error serving tracker: %s\n", http.Serve(l, t))
+	}()
+	go func() {
+		log.Printf("error serving udp tracker: %s\n", t.ServeUDP(pc))
+	}()
+	lanTracker = t
+	log.Printf("tracker listening on %s", addr)
+	return nil
+}
+
+// Announce url of the embedded tracker on the address, the url if it's set.
+func trackerAnnounceURL(url, addr string) string {
+	if url != "" {
+		return url
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/announce"
+}
+
+// Adds the url in a tier of its own unless it's in the tiers already.
+func addTracker(tiers [][]string, url string) [][]string {
+	for _, tier := range tiers {
+		for _, u := range tier {
+			if u == url {
+				return tiers
+			}
+		}
+	}
+	return append(tiers, []string{url})
+}
+
+// Trackers put into a created torrent: the trs, or without them the embedded
+// tracker of the url or the address, if any.
+func createdTrackers(trs []string, url, addr string) []string {
+	if len(trs) > 0 || url == "" && addr == "" {
+		return trs
+	}
+	return []string{trackerAnnounceURL(url, addr)}
+}
+
+// Lists swarms of the embedded tracker.
+func handleSwarms() {
+	http.HandleFunc("/swarms", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if lanTracker == nil {
+			http.Error(w, "tracker isn't running", http.StatusNotFound)
+			return
+		}
+		for _, sw := range lanTracker.Swarms() {
+			ih := metainfo.Hash(sw.InfoHash)
+			name := ""
+			if e := ttreg.get(ih); e != nil {
+				name = " " + e.t.Name()
+			}
+			fmt.Fprintf(w, "%s%s: %d seeders, %d leechers, %d downloaded\n", ih.HexString(), name, sw.Seeders, sw.Leechers, sw.Downloaded)
+		}
+	})
+}
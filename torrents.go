@@ -0,0 +1,207 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Torrent added from a watch dir.
+type ttEntry struct {
+	t  *torrent.Torrent
+	wd *watchDir
+	// Signalled to put a complete torrent back to the download queue.
+	requeue chan struct{}
+	// Signalled to pause the torrent while it's downloading or seeding.
+	pause chan struct{}
+	// Signalled when the download strategy is changed.
+	strategyChanged chan struct{}
+
+	mu     sync.Mutex
+	status string
+	// Source .torrent file while it's kept in the watch dir.
+	src string
+	// Source files of the same torrent added after it.
+	dups []string
+	// Url list of the metainfo, not kept by the client.
+	webSeeds []string
+	strategy string
+
+	paused     bool
+	disconnect bool
+	// Out of the queue while paused.
+	parked bool
+	// Max peer conns before peers were disconnected on pause.
+	maxConns int
+}
+
+func (e *ttEntry) setStatus(s string) {
+	e.mu.Lock()
+	e.status = s
+	e.mu.Unlock()
+}
+
+func (e *ttEntry) Status() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status
+}
+
+func (e *ttEntry) setSrc(fn string) {
+	e.mu.Lock()
+	e.src = fn
+	e.mu.Unlock()
+}
+
+func (e *ttEntry) Src() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.src
+}
+
+func (e *ttEntry) setStrategy(s string) {
+	e.mu.Lock()
+	e.strategy = s
+	e.mu.Unlock()
+	select {
+	case e.strategyChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (e *ttEntry) Strategy() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.strategy
+}
+
+func (e *ttEntry) addDup(fn string) {
+	e.mu.Lock()
+	e.dups = append(e.dups, fn)
+	e.mu.Unlock()
+}
+
+func (e *ttEntry) Dups() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.dups...)
+}
+
+// Marks the torrent paused and lets it know wherever it runs.
+func (e *ttEntry) setPaused(disconnect bool) {
+	e.mu.Lock()
+	e.paused = true
+	e.disconnect = disconnect
+	if e.parked && disconnect && e.maxConns == 0 {
+		e.maxConns = e.t.SetMaxEstablishedConns(0)
+	}
+	e.mu.Unlock()
+	select {
+	case e.pause <- struct{}{}:
+	default:
+	}
+}
+
+// Takes the paused torrent out of the queue, stopping piece requests, and
+// disconnects peers if asked or if it's seeding. Returns false if the
+// torrent isn't paused.
+func (e *ttEntry) park() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.paused || e.parked {
+		return false
+	}
+	e.parked = true
+	e.status = statusPaused
+	e.t.CancelPieces(0, e.t.NumPieces())
+	if e.disconnect || e.t.BytesMissing() == 0 {
+		e.maxConns = e.t.SetMaxEstablishedConns(0)
+	}
+	return true
+}
+
+// Lets peers connect again. Returns true if the torrent is out of the queue
+// and has to be put back.
+func (e *ttEntry) resume() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.paused {
+		return false
+	}
+	e.paused = false
+	if e.maxConns > 0 {
+		e.t.SetMaxEstablishedConns(e.maxConns)
+		e.maxConns = 0
+	}
+	if !e.parked {
+		return false
+	}
+	e.parked = false
+	e.status = "queued"
+	return true
+}
+
+// Torrents added to the client by torrentfs.
+type ttRegistry struct {
+	mu sync.Mutex
+	m  map[metainfo.Hash]*ttEntry
+}
+
+var ttreg = &ttRegistry{m: make(map[metainfo.Hash]*ttEntry)}
+
+func (r *ttRegistry) add(t *torrent.Torrent, wd *watchDir, src string, webSeeds []string) *ttEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.m[t.InfoHash()]
+	if !ok {
+		e = &ttEntry{t: t, wd: wd, requeue: make(chan struct{}, 1), pause: make(chan struct{}, 1), strategyChanged: make(chan struct{}, 1),
+			status: "queued", src: src, webSeeds: webSeeds, strategy: wd.Strategy}
+		r.m[t.InfoHash()] = e
+	}
+	return e
+}
+
+func (r *ttRegistry) get(ih metainfo.Hash) *ttEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.m[ih]
+}
+
+// Returns the torrent by hex info hash.
+func (r *ttRegistry) find(hs string) *ttEntry {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(hs); err != nil {
+		return nil
+	}
+	return r.get(ih)
+}
+
+func (r *ttRegistry) list() []*ttEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ret := make([]*ttEntry, 0, len(r.m))
+	for _, e := range r.m {
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// Returns the torrent added from the source file.
+func (r *ttRegistry) bySrc(fn string) *ttEntry {
+	for _, e := range r.list() {
+		if e.Src() == fn {
+			return e
+		}
+	}
+	return nil
+}
+
+// Drops the torrent from the client and forgets it.
+func (r *ttRegistry) drop(t *torrent.Torrent) {
+	r.mu.Lock()
+	delete(r.m, t.InfoHash())
+	r.mu.Unlock()
+	t.Drop()
+	dropTorrentRates(t.InfoHash())
+}
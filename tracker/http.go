@@ -0,0 +1,124 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+var httpEvents = map[string]Event{
+	"":          None,
+	"completed": Completed,
+	"started":   Started,
+	"stopped":   Stopped,
+}
+
+// Packs IPv4 peers as 6 bytes each, skipping others.
+func compactPeers(ps []Peer) []byte {
+	b := make([]byte, 0, 6*len(ps))
+	var port [2]byte
+	for _, p := range ps {
+		ip := p.IP.To4()
+		if ip == nil {
+			continue
+		}
+		binary.BigEndian.PutUint16(port[:], uint16(p.Port))
+		b = append(b, ip...)
+		b = append(b, port[:]...)
+	}
+	return b
+}
+
+func writeBencode(w http.ResponseWriter, v interface{}) {
+	b, err := bencode.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(b)
+}
+
+func httpFailure(w http.ResponseWriter, reason string) {
+	writeBencode(w, map[string]string{"failure reason": reason})
+}
+
+// Serves /announce and /scrape.
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/announce":
+		t.serveAnnounce(w, req)
+	case "/scrape":
+		t.serveScrape(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (t *Tracker) serveAnnounce(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	var ih InfoHash
+	if len(q.Get("info_hash")) != len(ih) {
+		httpFailure(w, "bad info_hash")
+		return
+	}
+	copy(ih[:], q.Get("info_hash"))
+	port, err := strconv.Atoi(q.Get("port"))
+	if err != nil || port <= 0 || port > 0xffff {
+		httpFailure(w, "bad port")
+		return
+	}
+	ev, ok := httpEvents[q.Get("event")]
+	if !ok {
+		httpFailure(w, "bad event")
+		return
+	}
+	left, _ := strconv.ParseUint(q.Get("left"), 10, 64)
+	numWant, _ := strconv.Atoi(q.Get("numwant"))
+	// The ip param isn't trusted, it would let clients announce others.
+	host, _, _ := net.SplitHostPort(req.RemoteAddr)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		httpFailure(w, "unknown ip")
+		return
+	}
+	ps, seeders, leechers := t.Announce(ih, Peer{ID: q.Get("peer_id"), IP: ip, Port: port}, ev, left, numWant)
+	resp := map[string]interface{}{
+		"interval":   int64(t.Interval / time.Second),
+		"complete":   seeders,
+		"incomplete": leechers,
+	}
+	if q.Get("compact") == "0" {
+		var l []map[string]interface{}
+		for _, p := range ps {
+			l = append(l, map[string]interface{}{"peer id": p.ID, "ip": p.IP.String(), "port": p.Port})
+		}
+		resp["peers"] = l
+	} else {
+		resp["peers"] = string(compactPeers(ps))
+	}
+	writeBencode(w, resp)
+}
+
+func (t *Tracker) serveScrape(w http.ResponseWriter, req *http.Request) {
+	files := make(map[string]interface{})
+	for _, s := range req.URL.Query()["info_hash"] {
+		var ih InfoHash
+		if len(s) != len(ih) {
+			httpFailure(w, "bad info_hash")
+			return
+		}
+		copy(ih[:], s)
+		sw := t.Scrape(ih)
+		files[s] = map[string]int{
+			"complete":   sw.Seeders,
+			"incomplete": sw.Leechers,
+			"downloaded": sw.Downloaded,
+		}
+	}
+	writeBencode(w, map[string]interface{}{"files": files})
+}
@@ -0,0 +1,149 @@
+package tracker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestCompactPeers(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		ps   []Peer
+		want []byte
+	}{
+		{"none", nil, []byte{}},
+		{"ipv4", []Peer{{IP: net.IPv4(1, 2, 3, 4), Port: 0x1a2b}}, []byte{1, 2, 3, 4, 0x1a, 0x2b}},
+		{"ipv6 skipped", []Peer{
+			{IP: net.ParseIP("::1"), Port: 1},
+			{IP: net.IPv4(1, 2, 3, 4).To4(), Port: 2},
+		}, []byte{1, 2, 3, 4, 0, 2}},
+	} {
+		if b := compactPeers(c.ps); !bytes.Equal(b, c.want) {
+			t.Errorf("%s: %v, want %v", c.name, b, c.want)
+		}
+	}
+}
+
+// Gets the path with the query from the tracker, decoding the bencoded
+// response.
+func getBencode(t *testing.T, srv *httptest.Server, path string, q url.Values) map[string]interface{} {
+	resp, err := http.Get(srv.URL + path + "?" + q.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := bencode.Unmarshal(b, &m); err != nil {
+		t.Fatalf("decoding %q: %s", b, err)
+	}
+	return m
+}
+
+func announceQuery(ih, port, event, left, compact string) url.Values {
+	q := url.Values{
+		"info_hash": {ih},
+		"peer_id":   {"-TT0000-000000000000"},
+		"port":      {port},
+		"left":      {left},
+	}
+	if event != "" {
+		q.Set("event", event)
+	}
+	if compact != "" {
+		q.Set("compact", compact)
+	}
+	return q
+}
+
+func TestHTTPAnnounce(t *testing.T) {
+	srv := httptest.NewServer(New(time.Minute))
+	defer srv.Close()
+	ih := string(make([]byte, 20))
+
+	for _, c := range []struct {
+		name    string
+		q       url.Values
+		failure string
+		peers   int
+	}{
+		{"short info_hash", announceQuery("abc", "1", "", "1", ""), "bad info_hash", 0},
+		{"bad port", announceQuery(ih, "x", "", "1", ""), "bad port", 0},
+		{"port out of range", announceQuery(ih, "65536", "", "1", ""), "bad port", 0},
+		{"bad event", announceQuery(ih, "1", "paused", "1", ""), "bad event", 0},
+		{"first", announceQuery(ih, "1", "started", "1", ""), "", 0},
+		{"compact", announceQuery(ih, "2", "started", "1", "1"), "", 1},
+		{"non-compact", announceQuery(ih, "3", "", "1", "0"), "", 2},
+	} {
+		m := getBencode(t, srv, "/announce", c.q)
+		if c.failure != "" {
+			if m["failure reason"] != c.failure {
+				t.Errorf("%s: failure %v, want %q", c.name, m["failure reason"], c.failure)
+			}
+			continue
+		}
+		if m["failure reason"] != nil {
+			t.Errorf("%s: failure %v", c.name, m["failure reason"])
+			continue
+		}
+		if m["interval"] != int64(60) {
+			t.Errorf("%s: interval %v", c.name, m["interval"])
+		}
+		switch ps := m["peers"].(type) {
+		case string:
+			if c.q.Get("compact") == "0" || len(ps) != 6*c.peers {
+				t.Errorf("%s: compact peers %q", c.name, ps)
+			}
+		case []interface{}:
+			if c.q.Get("compact") != "0" || len(ps) != c.peers {
+				t.Errorf("%s: peers %v", c.name, ps)
+			}
+			for _, p := range ps {
+				d, _ := p.(map[string]interface{})
+				if d["ip"] != "127.0.0.1" || d["peer id"] != c.q.Get("peer_id") {
+					t.Errorf("%s: peer %v", c.name, p)
+				}
+			}
+		case nil:
+			if c.peers != 0 {
+				t.Errorf("%s: no peers", c.name)
+			}
+		default:
+			t.Errorf("%s: peers %#v", c.name, ps)
+		}
+	}
+}
+
+func TestHTTPScrape(t *testing.T) {
+	tr := New(time.Minute)
+	srv := httptest.NewServer(tr)
+	defer srv.Close()
+	ih := InfoHash{1}
+	tr.Announce(ih, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Started, 0, 0)
+	tr.Announce(ih, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 2}, Started, 1, 0)
+
+	m := getBencode(t, srv, "/scrape", url.Values{"info_hash": {string(ih[:]), string(make([]byte, 20))}})
+	files, _ := m["files"].(map[string]interface{})
+	if len(files) != 2 {
+		t.Fatalf("scraped %v", m)
+	}
+	f, _ := files[string(ih[:])].(map[string]interface{})
+	if f["complete"] != int64(1) || f["incomplete"] != int64(1) || f["downloaded"] != int64(0) {
+		t.Errorf("scraped %v", f)
+	}
+	m = getBencode(t, srv, "/scrape", url.Values{"info_hash": {"abc"}})
+	if m["failure reason"] != "bad info_hash" {
+		t.Errorf("scraping a short info_hash: %v", m)
+	}
+}
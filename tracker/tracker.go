@@ -0,0 +1,180 @@
+// Package tracker provides a small BitTorrent tracker with HTTP (BEP 3, 23,
+// 48) and UDP (BEP 15) announce and scrape, keeping swarms in memory.
+package tracker
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type InfoHash [20]byte
+
+type Event int
+
+const (
+	None Event = iota
+	Completed
+	Started
+	Stopped
+)
+
+type Peer struct {
+	ID   string
+	IP   net.IP
+	Port int
+}
+
+type peer struct {
+	Peer
+	left uint64
+	seen time.Time
+}
+
+type swarm struct {
+	peers      map[string]*peer
+	downloaded int
+}
+
+// Counts of a swarm.
+type Swarm struct {
+	InfoHash   InfoHash
+	Seeders    int
+	Leechers   int
+	Downloaded int
+}
+
+type Tracker struct {
+	// Announce interval told to peers. Peers that don't announce for two
+	// intervals are forgotten, and swarms with them once empty.
+	Interval time.Duration
+	// Max peers returned by announce.
+	MaxPeers int
+
+	mu     sync.Mutex
+	swarms map[InfoHash]*swarm
+	swept  time.Time
+}
+
+func New(interval time.Duration) *Tracker {
+	return &Tracker{
+		Interval: interval,
+		MaxPeers: 50,
+		swarms:   make(map[InfoHash]*swarm),
+	}
+}
+
+func (t *Tracker) expire(s *swarm, now time.Time) {
+	for k, p := range s.peers {
+		if now.Sub(p.seen) > 2*t.Interval {
+			delete(s.peers, k)
+		}
+	}
+}
+
+// Expires peers of all swarms once an interval, forgetting the swarms left
+// without peers.
+func (t *Tracker) sweep(now time.Time) {
+	if now.Sub(t.swept) < t.Interval {
+		return
+	}
+	t.swept = now
+	for ih, s := range t.swarms {
+		t.expire(s, now)
+		if len(s.peers) == 0 {
+			delete(t.swarms, ih)
+		}
+	}
+}
+
+func (s *swarm) counts() (seeders, leechers int) {
+	for _, p := range s.peers {
+		if p.left == 0 {
+			seeders++
+		} else {
+			leechers++
+		}
+	}
+	return
+}
+
+// Records the peer in the swarm and returns other peers of it, with the
+// swarm counts.
+func (t *Tracker) Announce(ih InfoHash, p Peer, ev Event, left uint64, numWant int) (peers []Peer, seeders, leechers int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.sweep(now)
+	s, ok := t.swarms[ih]
+	if !ok {
+		s = &swarm{peers: make(map[string]*peer)}
+		t.swarms[ih] = s
+	}
+	t.expire(s, now)
+	key := net.JoinHostPort(p.IP.String(), strconv.Itoa(p.Port))
+	if ev == Stopped {
+		delete(s.peers, key)
+		if len(s.peers) == 0 {
+			delete(t.swarms, ih)
+		}
+	} else {
+		s.peers[key] = &peer{Peer: p, left: left, seen: now}
+		if ev == Completed {
+			s.downloaded++
+		}
+	}
+	if numWant <= 0 || numWant > t.MaxPeers {
+		numWant = t.MaxPeers
+	}
+	for k, op := range s.peers {
+		if len(peers) >= numWant {
+			break
+		}
+		// Seeders don't need each other.
+		if k == key || left == 0 && op.left == 0 {
+			continue
+		}
+		peers = append(peers, op.Peer)
+	}
+	seeders, leechers = s.counts()
+	return
+}
+
+func (t *Tracker) Scrape(ih InfoHash) (sw Swarm) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sw.InfoHash = ih
+	now := time.Now()
+	t.sweep(now)
+	s, ok := t.swarms[ih]
+	if !ok {
+		return
+	}
+	t.expire(s, now)
+	sw.Seeders, sw.Leechers = s.counts()
+	sw.Downloaded = s.downloaded
+	if len(s.peers) == 0 {
+		delete(t.swarms, ih)
+	}
+	return
+}
+
+// Returns counts of all swarms, by info hash.
+func (t *Tracker) Swarms() []Swarm {
+	t.mu.Lock()
+	ihs := make([]InfoHash, 0, len(t.swarms))
+	for ih := range t.swarms {
+		ihs = append(ihs, ih)
+	}
+	t.mu.Unlock()
+	sort.Slice(ihs, func(i, j int) bool {
+		return string(ihs[i][:]) < string(ihs[j][:])
+	})
+	ret := make([]Swarm, 0, len(ihs))
+	for _, ih := range ihs {
+		ret = append(ret, t.Scrape(ih))
+	}
+	return ret
+}
@@ -0,0 +1,96 @@
+package tracker
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAnnounce(t *testing.T) {
+	type announce struct {
+		port     int
+		ev       Event
+		left     uint64
+		numWant  int
+		peers    int
+		seeders  int
+		leechers int
+	}
+	for _, c := range []struct {
+		name      string
+		announces []announce
+	}{
+		{"first peer gets none", []announce{
+			{port: 1, left: 1, peers: 0, leechers: 1},
+		}},
+		{"leechers get each other", []announce{
+			{port: 1, left: 1, leechers: 1},
+			{port: 2, left: 1, peers: 1, leechers: 2},
+			{port: 1, left: 1, peers: 1, leechers: 2},
+		}},
+		{"seeders don't get seeders", []announce{
+			{port: 1, seeders: 1},
+			{port: 2, seeders: 2},
+			{port: 3, left: 1, peers: 2, seeders: 2, leechers: 1},
+			{port: 1, peers: 1, seeders: 2, leechers: 1},
+		}},
+		{"completed peer is a seeder", []announce{
+			{port: 1, left: 1, leechers: 1},
+			{port: 1, ev: Completed, seeders: 1},
+		}},
+		{"stopped peer is dropped", []announce{
+			{port: 1, left: 1, leechers: 1},
+			{port: 2, left: 1, peers: 1, leechers: 2},
+			{port: 2, ev: Stopped},
+			{port: 3, left: 1, peers: 1, leechers: 2},
+		}},
+		{"numwant limits peers", []announce{
+			{port: 1, left: 1, leechers: 1},
+			{port: 2, left: 1, peers: 1, leechers: 2},
+			{port: 3, left: 1, peers: 2, leechers: 3},
+			{port: 4, left: 1, numWant: 1, peers: 1, leechers: 4},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			tr := New(time.Minute)
+			var ih InfoHash
+			for i, a := range c.announces {
+				ps, seeders, leechers := tr.Announce(ih, Peer{IP: net.IPv4(127, 0, 0, 1), Port: a.port}, a.ev, a.left, a.numWant)
+				if a.ev == Stopped {
+					continue
+				}
+				if len(ps) != a.peers || seeders != a.seeders || leechers != a.leechers {
+					t.Errorf("announce %d: %d peers, %d seeders, %d leechers, want %d, %d, %d",
+						i, len(ps), seeders, leechers, a.peers, a.seeders, a.leechers)
+				}
+			}
+		})
+	}
+}
+
+func TestScrapeDownloaded(t *testing.T) {
+	tr := New(time.Minute)
+	var ih InfoHash
+	tr.Announce(ih, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Started, 1, 0)
+	tr.Announce(ih, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Completed, 0, 0)
+	tr.Announce(ih, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 2}, Started, 1, 0)
+	if sw := tr.Scrape(ih); sw.Seeders != 1 || sw.Leechers != 1 || sw.Downloaded != 1 {
+		t.Errorf("scraped %+v", sw)
+	}
+}
+
+func TestForgetEmptySwarms(t *testing.T) {
+	tr := New(10 * time.Millisecond)
+	ih1, ih2, ih3 := InfoHash{1}, InfoHash{2}, InfoHash{3}
+	tr.Announce(ih1, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Started, 1, 0)
+	tr.Announce(ih2, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Started, 1, 0)
+	tr.Announce(ih2, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Stopped, 1, 0)
+	if sws := tr.Swarms(); len(sws) != 1 || sws[0].InfoHash != ih1 {
+		t.Fatalf("swarms after the last peer stopped: %+v", sws)
+	}
+	time.Sleep(30 * time.Millisecond)
+	tr.Announce(ih3, Peer{IP: net.IPv4(127, 0, 0, 1), Port: 1}, Started, 1, 0)
+	if sws := tr.Swarms(); len(sws) != 1 || sws[0].InfoHash != ih3 {
+		t.Errorf("swarms after the peers expired: %+v", sws)
+	}
+}
@@ -0,0 +1,144 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	udpProtocolID = 0x41727101980
+
+	actionConnect  = 0
+	actionAnnounce = 1
+	actionScrape   = 2
+	actionError    = 3
+
+	// How long a connection id is accepted, per BEP 15.
+	udpConnTTL = 2 * time.Minute
+)
+
+type udpAnnounceRequest struct {
+	InfoHash   InfoHash
+	PeerID     [20]byte
+	Downloaded int64
+	Left       int64
+	Uploaded   int64
+	Event      int32
+	IP         uint32
+	Key        int32
+	NumWant    int32
+	Port       uint16
+}
+
+type udpServer struct {
+	t  *Tracker
+	pc net.PacketConn
+
+	mu    sync.Mutex
+	conns map[int64]time.Time
+}
+
+// Serves UDP announce and scrape on the conn until it's closed.
+func (t *Tracker) ServeUDP(pc net.PacketConn) error {
+	s := &udpServer{t: t, pc: pc, conns: make(map[int64]time.Time)}
+	b := make([]byte, 0x10000)
+	for {
+		n, addr, err := pc.ReadFrom(b)
+		if err != nil {
+			return err
+		}
+		s.serve(b[:n], addr)
+	}
+}
+
+func (s *udpServer) newConn() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, at := range s.conns {
+		if now.Sub(at) > udpConnTTL {
+			delete(s.conns, id)
+		}
+	}
+	id := rand.Int63()
+	s.conns[id] = now
+	return id
+}
+
+func (s *udpServer) connOk(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.conns[id]
+	return ok && time.Since(at) <= udpConnTTL
+}
+
+func (s *udpServer) respond(addr net.Addr, parts ...interface{}) {
+	var buf bytes.Buffer
+	for _, p := range parts {
+		binary.Write(&buf, binary.BigEndian, p)
+	}
+	s.pc.WriteTo(buf.Bytes(), addr)
+}
+
+func (s *udpServer) fail(addr net.Addr, tid int32, msg string) {
+	s.respond(addr, int32(actionError), tid, []byte(msg))
+}
+
+func (s *udpServer) serve(b []byte, addr net.Addr) {
+	r := bytes.NewReader(b)
+	var h struct {
+		ConnID int64
+		Action int32
+		TID    int32
+	}
+	if binary.Read(r, binary.BigEndian, &h) != nil {
+		return
+	}
+	if h.Action == actionConnect {
+		if h.ConnID == udpProtocolID {
+			s.respond(addr, int32(actionConnect), h.TID, s.newConn())
+		}
+		return
+	}
+	if !s.connOk(h.ConnID) {
+		s.fail(addr, h.TID, "bad connection id")
+		return
+	}
+	switch h.Action {
+	case actionAnnounce:
+		var req udpAnnounceRequest
+		if binary.Read(r, binary.BigEndian, &req) != nil {
+			s.fail(addr, h.TID, "bad announce")
+			return
+		}
+		// As with http, the ip of the request isn't trusted.
+		ua, ok := addr.(*net.UDPAddr)
+		if !ok {
+			s.fail(addr, h.TID, "unknown ip")
+			return
+		}
+		ip := ua.IP
+		ps, seeders, leechers := s.t.Announce(req.InfoHash, Peer{
+			ID:   string(req.PeerID[:]),
+			IP:   ip,
+			Port: int(req.Port),
+		}, Event(req.Event), uint64(req.Left), int(req.NumWant))
+		s.respond(addr, int32(actionAnnounce), h.TID, int32(s.t.Interval/time.Second),
+			int32(leechers), int32(seeders), compactPeers(ps))
+	case actionScrape:
+		var counts []int32
+		for r.Len() >= len(InfoHash{}) {
+			var ih InfoHash
+			r.Read(ih[:])
+			sw := s.t.Scrape(ih)
+			counts = append(counts, int32(sw.Seeders), int32(sw.Downloaded), int32(sw.Leechers))
+		}
+		s.respond(addr, int32(actionScrape), h.TID, counts)
+	default:
+		s.fail(addr, h.TID, "unknown action")
+	}
+}
@@ -0,0 +1,84 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// Conn recording the packets written to it.
+type recordConn struct {
+	net.PacketConn
+	out [][]byte
+}
+
+func (c *recordConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.out = append(c.out, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func packet(parts ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, p := range parts {
+		binary.Write(&buf, binary.BigEndian, p)
+	}
+	return buf.Bytes()
+}
+
+// Serves the packet, returning the response or nil without one.
+func serveUDP(s *udpServer, b []byte) []byte {
+	c := s.pc.(*recordConn)
+	c.out = nil
+	s.serve(b, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6881})
+	if len(c.out) == 0 {
+		return nil
+	}
+	return c.out[0]
+}
+
+func TestUDP(t *testing.T) {
+	tr := New(time.Minute)
+	s := &udpServer{t: tr, pc: &recordConn{}, conns: make(map[int64]time.Time)}
+	connect := serveUDP(s, packet(int64(udpProtocolID), int32(actionConnect), int32(7)))
+	if len(connect) != 16 || !bytes.Equal(connect[:8], packet(int32(actionConnect), int32(7))) {
+		t.Fatalf("connect response %v", connect)
+	}
+	connID := int64(binary.BigEndian.Uint64(connect[8:]))
+	tr.Announce(InfoHash{1}, Peer{IP: net.IPv4(10, 0, 0, 1), Port: 1}, Started, 0, 0)
+
+	announce := func(connID int64, left int64) []byte {
+		return packet(connID, int32(actionAnnounce), int32(7), udpAnnounceRequest{
+			InfoHash: InfoHash{1},
+			Left:     left,
+			Event:    int32(Started),
+			NumWant:  -1,
+			Port:     6881,
+		})
+	}
+	errorResp := func(msg string) []byte {
+		return packet(int32(actionError), int32(7), []byte(msg))
+	}
+	for _, c := range []struct {
+		name string
+		b    []byte
+		want []byte
+	}{
+		{"connect with a bad protocol id", packet(int64(1), int32(actionConnect), int32(7)), nil},
+		{"truncated header", packet(int64(udpProtocolID), int32(actionConnect)), nil},
+		{"bad connection id", announce(connID+1, 1), errorResp("bad connection id")},
+		{"truncated announce", announce(connID, 1)[:50], errorResp("bad announce")},
+		{"announce", announce(connID, 1), packet(int32(actionAnnounce), int32(7), int32(60),
+			int32(1), int32(1), []byte{10, 0, 0, 1, 0, 1})},
+		{"scrape", packet(connID, int32(actionScrape), int32(7), InfoHash{1}, InfoHash{2}),
+			packet(int32(actionScrape), int32(7), []int32{1, 0, 1, 0, 0, 0})},
+		{"truncated scrape", packet(connID, int32(actionScrape), int32(7), InfoHash{1})[:30],
+			packet(int32(actionScrape), int32(7))},
+		{"unknown action", packet(connID, int32(9), int32(7)), errorResp("unknown action")},
+	} {
+		if b := serveUDP(s, c.b); !bytes.Equal(b, c.want) {
+			t.Errorf("%s: %v, want %v", c.name, b, c.want)
+		}
+	}
+}
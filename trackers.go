@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Tier of the extra trackers.
+func extraTrackers() (ret []string) {
+	for _, u := range strings.Split(args.ExtraTrackers, ";") {
+		if u = strings.TrimSpace(u); u != "" {
+			ret = append(ret, u)
+		}
+	}
+	return
+}
+
+// Lists trackers of a running torrent by hash, after removing the remove
+// urls and then adding the add ones to the first tier.
+func handleTrackers() {
+	http.HandleFunc("/trackers", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req.ParseForm()
+		e := ttreg.find(req.FormValue("hash"))
+		if e == nil {
+			http.Error(w, "no torrents found", http.StatusNotFound)
+			return
+		}
+		for _, u := range req.Form["remove"] {
+			log.Printf("remove tracker %s from %s", u, e.t.Name())
+			e.t.RemoveTracker(u)
+		}
+		if add := req.Form["add"]; len(add) > 0 {
+			log.Printf("add trackers %v to %s", add, e.t.Name())
+			e.t.AddTrackers([][]string{add})
+		}
+		mi := e.t.Metainfo()
+		if mi.Announce != "" {
+			fmt.Fprintln(w, mi.Announce)
+		}
+		for i, tier := range mi.AnnounceList {
+			for _, u := range tier {
+				fmt.Fprintf(w, "%d: %s\n", i, u)
+			}
+		}
+	})
+}
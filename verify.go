@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/tagflag"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/covrom/torrentfs/store"
+)
+
+// The "verify" subcommand re-hashes the data of torrent files offline.
+func verifyExitCode(argv []string) int {
+	vargs := struct {
+		Dir     string        `help:"data dir of the torrents"`
+		Workers int           `help:"pieces hashed in parallel"`
+		Rate    tagflag.Bytes `help:"max bytes per second read from disk"`
+		tagflag.StartPos
+		Torrents []string `arity:"*" help:"torrent files, all of the dir by default"`
+	}{
+		Dir:     ".",
+		Workers: 2,
+		Rate:    -1,
+	}
+	tagflag.ParseArgs(&vargs, argv, tagflag.Program("torrentfs verify"))
+
+	fns := vargs.Torrents
+	if len(fns) == 0 {
+		fns, _ = filepath.Glob(filepath.Join(vargs.Dir, "*.torrent"))
+	}
+	pc, err := store.OpenPieceCompletion(vargs.Dir, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't open piece completion db in %q (is the daemon running? use /verify): %s\n", vargs.Dir, err)
+		return 1
+	}
+	sti := store.NewFileWithCompletion(vargs.Dir, pc)
+	defer sti.Close()
+
+	lim := bytesLimiter(vargs.Rate)
+	ret := 0
+	for _, fn := range fns {
+		mi, err := metainfo.LoadFromFile(fn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading %s: %s\n", fn, err)
+			ret = 1
+			continue
+		}
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading %s: %s\n", fn, err)
+			ret = 1
+			continue
+		}
+		ok, err := store.Verify(sti, &info, mi.HashInfoBytes(), vargs.Workers, lim)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error verifying %s: %s\n", fn, err)
+			ret = 1
+			continue
+		}
+		failed := numFailed(ok)
+		if failed > 0 {
+			ret = 1
+		}
+		fmt.Printf("%s: %d/%d pieces ok\n", info.Name, len(ok)-failed, len(ok))
+	}
+	return ret
+}
+
+func numFailed(ok []bool) (n int) {
+	for _, c := range ok {
+		if !c {
+			n++
+		}
+	}
+	return
+}
+
+// Re-hashes a running torrent, lets the client know about changed pieces and
+// puts the torrent back to the download queue if some pieces fail.
+func verifyTorrent(e *ttEntry) {
+	<-e.t.GotInfo()
+	fn := e.t.Name()
+	log.Printf("verifying %s", fn)
+	ok, err := store.Verify(e.wd.raw, e.t.Info(), e.t.InfoHash(), args.VerifyWorkers, bytesLimiter(args.VerifyRate))
+	if err != nil {
+		log.Printf("error verifying %s: %s\n", fn, err)
+		return
+	}
+	for i, c := range ok {
+		if c != e.t.PieceState(i).Complete {
+			e.t.Piece(i).VerifyData()
+		}
+	}
+	failed := numFailed(ok)
+	log.Printf("verified %s: %d/%d pieces ok", fn, len(ok)-failed, len(ok))
+	if failed > 0 {
+		select {
+		case e.requeue <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Verifies a torrent by hash, or all torrents of a watch dir.
+func handleVerify() {
+	http.HandleFunc("/verify", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hs := req.FormValue("hash")
+		dir := req.FormValue("dir")
+		var es []*ttEntry
+		for _, e := range ttreg.list() {
+			if e.t.InfoHash().String() == hs || (dir != "" && e.wd.Dir == dir) {
+				es = append(es, e)
+			}
+		}
+		if len(es) == 0 {
+			http.Error(w, "no torrents found", http.StatusNotFound)
+			return
+		}
+		go func() {
+			for _, e := range es {
+				verifyTorrent(e)
+			}
+		}()
+		http.Redirect(w, req, "/", http.StatusSeeOther)
+	})
+}
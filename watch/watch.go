@@ -0,0 +1,262 @@
+// Package watch provides tracking of torrent info files in a directory,
+// optionally including its subdirectories, by filesystem notifications or
+// polling.
+package watch
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type Change uint
+
+const (
+	Added Change = iota
+	Removed
+)
+
+type Event struct {
+	Change
+	TorrentFilePath string
+	// Subdirectory of the watched dir with the file, slash separated. Empty
+	// for the watched dir itself.
+	Category string
+}
+
+// Ways to notice changes in the dir.
+const (
+	ModeNotify = "inotify" // Filesystem notifications.
+	// Rescans at the poll interval, for network and FUSE filesystems that
+	// don't deliver notifications.
+	ModePoll = "poll"
+	ModeBoth = "both"
+)
+
+type Options struct {
+	// One of the modes, notifications by default.
+	Mode         string
+	PollInterval time.Duration
+	// Watch subdirectories too, except hidden ones and those Skip reports
+	// true for.
+	Recursive bool
+	Skip      func(dir string) bool
+}
+
+type Instance struct {
+	w       *fsnotify.Watcher
+	dirName string
+	opts    Options
+	Events  chan Event
+	closed  chan struct{}
+	once    sync.Once
+
+	mu       sync.Mutex
+	dirs     map[string]bool
+	dirState map[string]string
+}
+
+func New(dirName string, opts Options) (i *Instance, err error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeNotify
+	}
+	if opts.Skip == nil {
+		opts.Skip = func(string) bool { return false }
+	}
+	// Checked before the watcher is created, so it isn't leaked.
+	if (opts.Mode == ModePoll || opts.Mode == ModeBoth) && opts.PollInterval <= 0 {
+		return nil, fmt.Errorf("bad poll interval %s", opts.PollInterval)
+	}
+	i = &Instance{
+		dirName:  dirName,
+		opts:     opts,
+		Events:   make(chan Event),
+		closed:   make(chan struct{}),
+		dirs:     map[string]bool{dirName: true},
+		dirState: make(map[string]string),
+	}
+	switch opts.Mode {
+	case ModeNotify, ModeBoth:
+		i.w, err = fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		err = i.w.Add(dirName)
+		if err != nil {
+			i.w.Close()
+			return nil, err
+		}
+	case ModePoll:
+		var fi os.FileInfo
+		fi, err = os.Stat(dirName)
+		if err == nil && !fi.IsDir() {
+			err = fmt.Errorf("%s is not a dir", dirName)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown watch mode %q", opts.Mode)
+	}
+	go func() {
+		i.refresh()
+		if i.w != nil {
+			go i.handleEvents()
+			go i.handleErrors()
+		}
+		if opts.Mode != ModeNotify {
+			go i.poll()
+		}
+	}()
+	return
+}
+
+func (i *Instance) Close() {
+	i.once.Do(func() {
+		close(i.closed)
+		if i.w != nil {
+			i.w.Close()
+		}
+	})
+}
+
+// Delay of a refresh after a notification, so that the ones following it
+// are handled by the same scan.
+const refreshDelay = 200 * time.Millisecond
+
+func (i *Instance) handleEvents() {
+	var refresh <-chan time.Time
+	for {
+		select {
+		case e, ok := <-i.w.Events:
+			if !ok {
+				return
+			}
+			if e.Op != fsnotify.Chmod && refresh == nil {
+				refresh = time.After(refreshDelay)
+			}
+		case <-refresh:
+			refresh = nil
+			i.refresh()
+		}
+	}
+}
+
+func (i *Instance) handleErrors() {
+	for err := range i.w.Errors {
+		log.Printf("error in torrent directory watcher: %s", err)
+	}
+}
+
+func (i *Instance) poll() {
+	tck := time.NewTicker(i.opts.PollInterval)
+	defer tck.Stop()
+	for {
+		select {
+		case <-i.closed:
+			return
+		case <-tck.C:
+			i.refresh()
+		}
+	}
+}
+
+// Returns the .torrent files under the dir, with their categories. Starts
+// watching new subdirectories and forgets the gone ones.
+func (i *Instance) scanDir() (ret map[string]string) {
+	ret = make(map[string]string)
+	seen := map[string]bool{i.dirName: true}
+	defer func() {
+		for dir := range i.dirs {
+			if !seen[dir] {
+				if i.w != nil {
+					i.w.Remove(dir)
+				}
+				delete(i.dirs, dir)
+			}
+		}
+	}()
+	filepath.Walk(i.dirName, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			log.Print(err)
+			return nil
+		}
+		if fi.IsDir() {
+			if path == i.dirName {
+				return nil
+			}
+			if !i.opts.Recursive || strings.HasPrefix(fi.Name(), ".") || i.opts.Skip(path) {
+				return filepath.SkipDir
+			}
+			seen[path] = true
+			i.watchDir(path)
+			return nil
+		}
+		if filepath.Ext(path) != ".torrent" {
+			return nil
+		}
+		cat, _ := filepath.Rel(i.dirName, filepath.Dir(path))
+		if cat == "." {
+			cat = ""
+		}
+		ret[path] = filepath.ToSlash(cat)
+		return nil
+	})
+	return
+}
+
+func (i *Instance) watchDir(dir string) {
+	if i.dirs[dir] {
+		return
+	}
+	if i.w != nil {
+		if err := i.w.Add(dir); err != nil {
+			log.Printf("error watching %s: %s", dir, err)
+			return
+		}
+	}
+	i.dirs[dir] = true
+}
+
+// Rescans the dir, reporting the changes missed by notifications.
+func (i *Instance) Rescan() {
+	i.refresh()
+}
+
+func (i *Instance) refresh() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_new := i.scanDir()
+	for path, cat := range i.dirState {
+		if _, ok := _new[path]; !ok {
+			i.send(Event{
+				Change:          Removed,
+				TorrentFilePath: path,
+				Category:        cat,
+			})
+		}
+	}
+	for path, cat := range _new {
+		if _, ok := i.dirState[path]; !ok {
+			i.send(Event{
+				Change:          Added,
+				TorrentFilePath: path,
+				Category:        cat,
+			})
+		}
+	}
+	i.dirState = _new
+}
+
+func (i *Instance) send(e Event) {
+	select {
+	case i.Events <- e:
+	case <-i.closed:
+	}
+}
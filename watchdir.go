@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/tagflag"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/covrom/torrentfs/store"
+	"golang.org/x/time/rate"
+)
+
+type watchDir struct {
+	Dir     string
+	Storage string
+	// Where the data and the piece completion are stored, the dir itself if
+	// empty.
+	Data string
+	// Category of the torrents stored here, empty for the watch dir itself.
+	Category string
+	// Watch subdirectories too, each as a category.
+	Recursive bool
+	// How changes are noticed: inotify, poll or both.
+	WatchMode    string
+	PollInterval time.Duration
+	// Drop torrents whose kept .torrent files are removed.
+	DropRemoved bool
+	// What to do with the source .torrent file once it's queued.
+	Ingest     string
+	ArchiveDir string
+	FailedDir  string
+	// Seeding time after download.
+	AliveMinutes int
+	// Minutes without progress after which a download gives its slot up.
+	StallMinutes int
+	// Order of downloading pieces.
+	Strategy     string
+	UploadRate   tagflag.Bytes
+	DownloadRate tagflag.Bytes
+	// Limiters of the dir, set from the rates above and changed at runtime.
+	rates *rates
+
+	// Upload limiters of the dir and of the dir its storage is shared with,
+	// set on its torrents.
+	upLims []*rate.Limiter
+
+	raw storage.ClientImpl // Not throttled.
+	sti storage.ClientImpl
+	pc  store.PieceCompletion
+	// Storage is owned by another watch dir.
+	shared bool
+
+	mu   sync.Mutex
+	cats map[string]*watchDir
+}
+
+func newWatchDir(dir string) *watchDir {
+	return &watchDir{
+		Dir:          dir,
+		Storage:      args.Storage,
+		Recursive:    args.Recursive,
+		WatchMode:    args.WatchMode,
+		PollInterval: args.PollInterval,
+		DropRemoved:  args.DropRemoved,
+		Ingest:       args.IngestAction,
+		ArchiveDir:   args.ArchiveDir,
+		FailedDir:    args.FailedDir,
+		AliveMinutes: args.AliveMinutes,
+		StallMinutes: args.StallMinutes,
+		Strategy:     args.Strategy,
+		UploadRate:   -1,
+		DownloadRate: -1,
+		rates:        newRates(1<<20, 1<<20),
+	}
+}
+
+// Parses a watch dir location with optional settings, in the form
+// path?name=value&name=value.
+func parseWatchDir(s string) (*watchDir, error) {
+	s = strings.TrimSpace(s)
+	wd := newWatchDir(s)
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		wd.Dir = s[:i]
+		if err := wd.parseSettings(s[i+1:], nil); err != nil {
+			return nil, err
+		}
+	}
+	// File storage makes a dir of each torrent's data, which would be taken
+	// for a category with its .torrent files watched.
+	if wd.Recursive && (wd.Storage == store.BackendFile || wd.Storage == store.BackendMMap) &&
+		(wd.Data == "" || filepath.Clean(wd.Data) == filepath.Clean(wd.Dir)) {
+		return nil, fmt.Errorf("recursive watch dir %s needs a separate data path, set %s?data=path", wd.Dir, wd.Dir)
+	}
+	return wd, checkIngestAction(wd.Ingest)
+}
+
+// Settings not known to the dir are passed to more if it isn't nil.
+func (wd *watchDir) parseSettings(s string, more func(k, v string) error) error {
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		return err
+	}
+	for k, vs := range q {
+		v := vs[len(vs)-1]
+		switch k {
+		case "storage":
+			wd.Storage = v
+		case "data":
+			wd.Data = v
+		case "recursive":
+			wd.Recursive, err = strconv.ParseBool(v)
+		case "watch":
+			wd.WatchMode = v
+		case "poll":
+			wd.PollInterval, err = time.ParseDuration(v)
+		case "dropremoved":
+			wd.DropRemoved, err = strconv.ParseBool(v)
+		case "ingest":
+			wd.Ingest = v
+		case "archive":
+			wd.ArchiveDir = v
+		case "failed":
+			wd.FailedDir = v
+		case "alive":
+			wd.AliveMinutes, err = strconv.Atoi(v)
+		case "stall":
+			wd.StallMinutes, err = strconv.Atoi(v)
+		case "strategy":
+			wd.Strategy = v
+			err = checkStrategy(v)
+		case "up":
+			wd.UploadRate, err = parseRate(v)
+		case "down":
+			wd.DownloadRate, err = parseRate(v)
+		default:
+			if more == nil {
+				return fmt.Errorf("unknown setting %q", k)
+			}
+			err = more(k, v)
+		}
+		if err != nil {
+			return fmt.Errorf("setting %q: %s", k, err)
+		}
+	}
+	wd.rates.set(wd.UploadRate, wd.DownloadRate)
+	return nil
+}
+
+// Opens the piece completion and the storage of the dir.
+func (wd *watchDir) open() (err error) {
+	if wd.Storage == store.BackendMemory {
+		wd.pc = store.NewMapPieceCompletion()
+	} else {
+		wd.pc, err = store.OpenPieceCompletion(wd.dataDir(), args.StrictCompletion)
+		if err != nil {
+			return
+		}
+	}
+	wd.raw, err = store.Open(wd.Storage, wd.dataDir(), wd.pc)
+	if err != nil {
+		wd.pc.Close()
+		return
+	}
+	wd.sti = store.ThrottledTorrents(wd.throttled(wd.raw), torrentDownLimiter)
+	wd.upLims = []*rate.Limiter{wd.rates.up}
+	return
+}
+
+// Wraps the storage with the download rate limit of the dir.
+func (wd *watchDir) throttled(sti storage.ClientImpl) storage.ClientImpl {
+	return store.Throttled(sti, wd.rates.down)
+}
+
+func (wd *watchDir) close() error {
+	if wd.shared {
+		return nil
+	}
+	err := wd.raw.Close()
+	if err1 := wd.pc.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func (wd *watchDir) dataDir() string {
+	if wd.Data == "" {
+		return wd.Dir
+	}
+	return wd.Data
+}
+
+// Dirs not watched for .torrent files in recursive mode.
+func (wd *watchDir) skip(dir string) bool {
+	if dir == wd.subdir(wd.ArchiveDir) || dir == wd.subdir(wd.FailedDir) ||
+		wd.Data != "" && filepath.Clean(dir) == filepath.Clean(wd.Data) {
+		return true
+	}
+	return cats.isDataDir(dir)
+}
+
+// Returns nil if the piece completion of the dir is persisted.
+func (wd *watchDir) health() error {
+	if hc, ok := wd.pc.(store.HealthChecker); ok {
+		return hc.Health()
+	}
+	return nil
+}
+
+func (wd *watchDir) Status() string {
+	if err := wd.health(); err != nil {
+		return "unhealthy: " + err.Error()
+	}
+	return "ok"
+}
+
+type watchDirs struct {
+	mu sync.Mutex
+	ds []*watchDir
+	// Dirs of torrents seeded by /create, not watched nor listed.
+	seeds map[string]*watchDir
+}
+
+func (wds *watchDirs) add(wd *watchDir) {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	wds.ds = append(wds.ds, wd)
+}
+
+// Watch dir of the dir given at start. Data paths of categories, also in
+// the list, aren't matched.
+func (wds *watchDirs) get(dir string) *watchDir {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	for _, wd := range wds.ds {
+		if wd.Category == "" && filepath.Clean(wd.Dir) == filepath.Clean(dir) {
+			return wd
+		}
+	}
+	return nil
+}
+
+// Watch dir storing its data in dir.
+func (wds *watchDirs) getData(dir string) *watchDir {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	for _, wd := range wds.ds {
+		if filepath.Clean(wd.dataDir()) == filepath.Clean(dir) {
+			return wd
+		}
+	}
+	return nil
+}
+
+func (wds *watchDirs) list() []*watchDir {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	return append([]*watchDir(nil), wds.ds...)
+}
+
+// Closes the storage of the seed dirs.
+func (wds *watchDirs) closeSeeds() {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	for dir, wd := range wds.seeds {
+		if err := wd.close(); err != nil {
+			log.Printf("error closing %s: %s\n", dir, err)
+		}
+		delete(wds.seeds, dir)
+	}
+}
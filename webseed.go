@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"golang.org/x/time/rate"
+)
+
+// Used for fetching pieces from web seeds.
+var webSeedClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Delay before retrying after all web seeds of a piece failed.
+const webSeedRetryInterval = 30 * time.Second
+
+// Web seed host with its own concurrency and rate limits, shared by all
+// torrents.
+type webSeedHost struct {
+	sem chan struct{}
+	lim *rate.Limiter
+
+	Bytes  int64
+	Pieces int64
+	Errors int64
+}
+
+var webSeedHosts = struct {
+	mu sync.Mutex
+	m  map[string]*webSeedHost
+}{m: make(map[string]*webSeedHost)}
+
+func webSeedHostFor(host string) *webSeedHost {
+	webSeedHosts.mu.Lock()
+	defer webSeedHosts.mu.Unlock()
+	h, ok := webSeedHosts.m[host]
+	if !ok {
+		conns := args.WebSeedConns
+		if conns < 1 {
+			conns = 1
+		}
+		h = &webSeedHost{sem: make(chan struct{}, conns), lim: bytesLimiter(args.WebSeedRate)}
+		webSeedHosts.m[host] = h
+	}
+	return h
+}
+
+// Writes traffic of each web seed host.
+func writeWebSeedStatus(w io.Writer) {
+	webSeedHosts.mu.Lock()
+	defer webSeedHosts.mu.Unlock()
+	hs := make([]string, 0, len(webSeedHosts.m))
+	for host := range webSeedHosts.m {
+		hs = append(hs, host)
+	}
+	sort.Strings(hs)
+	for _, host := range hs {
+		h := webSeedHosts.m[host]
+		fmt.Fprintf(w, "%s: %d bytes, %d pieces, %d errors\n", host,
+			atomic.LoadInt64(&h.Bytes), atomic.LoadInt64(&h.Pieces), atomic.LoadInt64(&h.Errors))
+	}
+}
+
+func init() {
+	expvar.Publish("webSeeds", expvar.Func(func() interface{} {
+		webSeedHosts.mu.Lock()
+		defer webSeedHosts.mu.Unlock()
+		m := make(map[string]map[string]int64)
+		for host, h := range webSeedHosts.m {
+			m[host] = map[string]int64{
+				"bytes":  atomic.LoadInt64(&h.Bytes),
+				"pieces": atomic.LoadInt64(&h.Pieces),
+				"errors": atomic.LoadInt64(&h.Errors),
+			}
+		}
+		return m
+	}))
+}
+
+// Url of the file on the web seed, per BEP 19.
+func webSeedFileURL(base string, info *metainfo.Info, fi metainfo.FileInfo) string {
+	if !info.IsDir() && !strings.HasSuffix(base, "/") {
+		return base
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	ps := []string{url.PathEscape(info.Name)}
+	for _, p := range fi.Path {
+		ps = append(ps, url.PathEscape(p))
+	}
+	return base + strings.Join(ps, "/")
+}
+
+// Reads length bytes at off of the file into w, throttled by the host, until
+// ctx is done.
+func fetchRange(ctx context.Context, h *webSeedHost, u string, off, length int64, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", args.FetchUserAgent)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+	resp, err := webSeedClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK && off == 0:
+		// Range ignored, the head of the whole file does as well.
+	default:
+		return fmt.Errorf("fetching %s: %s", u, resp.Status)
+	}
+	buf := make([]byte, 16<<10)
+	r := io.LimitReader(resp.Body, length)
+	var n int64
+	for n < length {
+		m, err := r.Read(buf)
+		if m > 0 {
+			if h.lim != nil {
+				if err := h.lim.WaitN(ctx, m); err != nil {
+					return err
+				}
+			}
+			w.Write(buf[:m])
+			n += int64(m)
+			atomic.AddInt64(&h.Bytes, int64(m))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if n < length {
+		return fmt.Errorf("fetching %s: short response", u)
+	}
+	return nil
+}
+
+// Fetches the piece from the web seed, spanning files as needed, until ctx
+// is done.
+func fetchPiece(ctx context.Context, base string, info *metainfo.Info, p metainfo.Piece) ([]byte, error) {
+	bu, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	h := webSeedHostFor(bu.Host)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case h.sem <- struct{}{}:
+	}
+	defer func() { <-h.sem }()
+
+	var buf bytes.Buffer
+	start, end := p.Offset(), p.Offset()+p.Length()
+	var foff int64
+	for _, fi := range info.UpvertedFiles() {
+		fend := foff + fi.Length
+		if fend > start && foff < end {
+			off := start - foff
+			if off < 0 {
+				off = 0
+			}
+			length := fi.Length - off
+			if rest := end - (foff + off); rest < length {
+				length = rest
+			}
+			if err := fetchRange(ctx, h, webSeedFileURL(base, info, fi), off, length, &buf); err != nil {
+				atomic.AddInt64(&h.Errors, 1)
+				return nil, err
+			}
+		}
+		foff = fend
+	}
+	if sha1.Sum(buf.Bytes()) != p.Hash() {
+		atomic.AddInt64(&h.Errors, 1)
+		return nil, errors.New("piece hash mismatch")
+	}
+	atomic.AddInt64(&h.Pieces, 1)
+	return buf.Bytes(), nil
+}
+
+// Downloads missing pieces of the torrent from its web seeds, in the order
+// of its strategy, while fewer seeders than args.WebSeedSeeders are
+// connected, until stop is closed.
+// Pieces are written to the storage, marked complete and handed to the
+// client to check.
+func runWebSeeds(e *ttEntry, urls []string, stop <-chan struct{}) {
+	t := e.t
+	<-t.GotInfo()
+	info := t.Info()
+	ih := t.InfoHash()
+	ts, err := e.wd.sti.OpenTorrent(info, ih)
+	if err != nil {
+		log.Printf("error opening storage for web seeds of %s: %s\n", t.Name(), err)
+		return
+	}
+	defer ts.Close()
+
+	// Cancels fetches in flight on stop, before the storage is closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	pieces := make(chan int)
+	var wg sync.WaitGroup
+	workers := args.WebSeedConns
+	if workers < 1 {
+		workers = 1
+	}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range pieces {
+				p := info.Piece(i)
+				var b []byte
+				for _, u := range urls {
+					var err error
+					if b, err = fetchPiece(ctx, u, info, p); err == nil {
+						break
+					}
+					if ctx.Err() != nil {
+						return
+					}
+					log.Printf("error fetching piece %d of %s from web seed %s: %s\n", i, t.Name(), u, err)
+				}
+				if b == nil {
+					select {
+					case <-stop:
+					case <-time.After(webSeedRetryInterval):
+					}
+					continue
+				}
+				pi := ts.Piece(p)
+				if _, err := pi.WriteAt(b, 0); err != nil {
+					log.Printf("error writing piece %d of %s from web seed: %s\n", i, t.Name(), err)
+					continue
+				}
+				pi.MarkComplete()
+				t.Piece(i).VerifyData()
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(pieces)
+
+	for {
+		for _, i := range strategyOrder(t, e.Strategy()) {
+			for t.Stats().ConnectedSeeders >= args.WebSeedSeeders {
+				select {
+				case <-stop:
+					return
+				case <-time.After(webSeedRetryInterval):
+				}
+			}
+			// Pieces coming from peers are left to them.
+			if t.PieceState(i).Complete || t.PieceRequested(i) {
+				continue
+			}
+			select {
+			case <-stop:
+				return
+			case pieces <- i:
+			}
+		}
+		if t.BytesMissing() == 0 {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(webSeedRetryInterval):
+		}
+	}
+}
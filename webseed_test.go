@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Adds the torrent of a file of random data in a new dir to a new client, of
+// a storage in another new dir. Returns the entry of the torrent, the dir of
+// the file and a func closing the client and removing the dirs.
+func newWebSeedTorrent(t *testing.T) (*ttEntry, string, func()) {
+	src, err := ioutil.TempDir("", "torrentfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := ioutil.TempDir("", "torrentfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 100<<10)
+	rand.Read(b)
+	if err := ioutil.WriteFile(filepath.Join(src, "a"), b, 0660); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: 16 << 10}
+	if err := info.BuildFromFilePath(filepath.Join(src, "a")); err != nil {
+		t.Fatal(err)
+	}
+
+	sti := storage.NewFileWithCompletion(dst, storage.NewMapPieceCompletion())
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = dst
+	cfg.DefaultStorage = sti
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.DisableIPv6 = true
+	cfg.SetListenAddr("127.0.0.1:0")
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ib, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt, _, err := client.AddTorrentSpec(&torrent.TorrentSpec{InfoHash: metainfo.HashBytes(ib), InfoBytes: ib})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ttEntry{t: tt, wd: &watchDir{sti: sti}}, src, func() {
+		client.Close()
+		os.RemoveAll(src)
+		os.RemoveAll(dst)
+	}
+}
+
+// Runs the web seeds of the torrent, closing the returned chan once they end.
+func startWebSeeds(e *ttEntry, urls []string, stop chan struct{}) chan struct{} {
+	ended := make(chan struct{})
+	go func() {
+		defer close(ended)
+		runWebSeeds(e, urls, stop)
+	}()
+	return ended
+}
+
+func TestWebSeeds(t *testing.T) {
+	e, src, cleanup := newWebSeedTorrent(t)
+	defer cleanup()
+	srv := httptest.NewServer(http.FileServer(http.Dir(src)))
+	defer srv.Close()
+
+	stop := make(chan struct{})
+	ended := startWebSeeds(e, []string{srv.URL + "/a"}, stop)
+	timeout := time.After(10 * time.Second)
+	for e.t.BytesMissing() > 0 {
+		select {
+		case <-ended:
+			t.Fatalf("web seeds ended with %d bytes missing", e.t.BytesMissing())
+		case <-timeout:
+			close(stop)
+			t.Fatalf("%d bytes missing", e.t.BytesMissing())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	close(stop)
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("web seeds didn't end on stop")
+	}
+}
+
+func TestWebSeedsStop(t *testing.T) {
+	e, _, cleanup := newWebSeedTorrent(t)
+	defer cleanup()
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	stop := make(chan struct{})
+	ended := startWebSeeds(e, []string{srv.URL + "/a"}, stop)
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		close(stop)
+		t.Fatal("no piece requested")
+	}
+	close(stop)
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("web seeds didn't end on stop with a fetch in flight")
+	}
+}
+
+func TestStrategyOrder(t *testing.T) {
+	e, _, cleanup := newWebSeedTorrent(t)
+	defer cleanup()
+	for _, c := range []struct {
+		strategy string
+		want     []int
+	}{
+		{strategySequential, []int{0, 1, 2, 3, 4, 5, 6}},
+		{strategyFirstLast, []int{0, 6, 1, 2, 3, 4, 5}},
+		// No peers, so all pieces are as rare.
+		{strategyRarest, []int{0, 1, 2, 3, 4, 5, 6}},
+	} {
+		if got := strategyOrder(e.t, c.strategy); fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%s: %v, want %v", c.strategy, got, c.want)
+		}
+	}
+}